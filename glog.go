@@ -671,6 +671,11 @@ func (l *loggingT) printWithFileLine(s severity, file string, line int, alsoToSt
 
 // output writes the data to the log files and releases the buffer.
 func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	if ReentrancyGuard && reentrant() {
+		dropReentrant(buf.Bytes())
+		l.putBuffer(buf)
+		return
+	}
 	l.mu.Lock()
 	if l.traceLocation.isSet() {
 		if l.traceLocation.match(file, line) {
@@ -679,7 +684,7 @@ func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoTo
 	}
 	data := buf.Bytes()
 	// if logstash is enabled and severity is not fatal then write the data to it
-	if logstash.toLogstash && s != fatalLog {
+	if logstash.enabled() && s != fatalLog {
 		logstash.WriteWithStack(data, nil) // without stack
 	}
 
@@ -729,8 +734,10 @@ func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoTo
 		// Write the stack trace for all goroutines to the files.
 		trace := stacks(true)
 		// if logstash is enabled and setup then write the data and stack to it
-		if logstash.toLogstash {
+		if logstash.enabled() {
 			logstash.WriteWithStack(data, trace)
+		} else if fatalSink != nil {
+			writeFatalWithStack(data, trace)
 		}
 		logExitFunc = func(error) {} // If we get a write error, we'll still exit below.
 		for log := fatalLog; log >= infoLog; log-- {
@@ -914,7 +921,7 @@ func (l *loggingT) flushAll() {
 		}
 	}
 	// flush pending logstash messages
-	if logstash.toLogstash {
+	if logstash.enabled() {
 		logstash.flush()
 	}
 }
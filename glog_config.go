@@ -0,0 +1,372 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Config is a snapshot of the JSON configuration: the option variables, the settings of the
+// Set functions, the hooks, tag rules and ExtraFields. The writers and sinks are not part of it.
+type Config struct {
+	// options
+	parseTrailer           bool
+	splitEmbeddedStack     bool
+	marshalLatency         bool
+	eventID                bool
+	includeHostIP          bool
+	fastMode               bool
+	levelText              bool
+	timestampNanos         bool
+	stackDepth             bool
+	base64BinaryMessages   bool
+	trackTransforms        bool
+	normalizeWhitespace    bool
+	preserveNewlines       bool
+	sinceLast              bool
+	goroutineCount         bool
+	uptime                 bool
+	monotonicNanos         bool
+	reentrancyGuard        bool
+	repanicAfterRecover    bool
+	sourceCode             bool
+	stackAsLines           bool
+	parseNestedJSON        bool
+	fallbackToStdJSON      bool
+	stackOrigin            bool
+	hasStack               bool
+	levelValue             bool
+	parseInlineHost        bool
+	omitSourceHost         bool
+	esCompatTimestamps     bool
+	platform               bool
+	duplicateKeyPolicy     KeyPolicy
+	tagOverflowPolicy      TagPolicy
+	malformedLinePolicy    LinePolicy
+	unknownLineNumber      LineNumberPolicy
+	severityCase           LetterCase
+	severityNumbering      Numbering
+	writerSwapPolicy       SwapPolicy
+	truncatedLineLength    int
+	severityPrefixSearch   int
+	maxEventBytes          int
+	maxStackBytes          int
+	stackTopFrames         int
+	maxTags                int
+	maxNestedJSONBytes     int
+	maxStackFrames         int
+	maxFieldValueBytes     int
+	vEnabledLevel          Level
+	stringIntegersAbove    uint64
+	stackDedupWindow       time.Duration
+	minTimestampResolution time.Duration
+	prettyAboveSeverity    Severity
+	goroutineCountSeverity Severity
+	plainMessageSeverity   Severity
+	recoverSeverity        Severity
+	// settings
+	severityInference func(data []byte) (Severity, bool)
+	eventIDGenerator  func() string
+	stackPredicate    func(ev *Event) bool
+	levelNames        [numSeverity]string
+	customLevelNames  map[Severity]string
+	alertThreshold    Severity
+	severityOrdinals  map[Severity]int
+	severityScores    map[Severity]int
+	fieldSeverities   map[string]Severity
+	fieldKinds        map[string]FieldKind
+	region, zone      string
+	baseYear          int
+	filePathPrefix    string
+	sourceRoot        string
+	stackIndent       string
+	originSkip        []string
+	fieldOrder        []string
+	fileFilter        []string
+	fieldsKey         string
+	fieldKeys         FieldKeys
+	rootWrapper       string
+	syslogLineFields  []string
+	severityIcons     map[Severity]string
+	hooks             []Hook
+	tagRules          []tagRule
+	extraFields       map[string]string
+	extraValues       map[string]interface{}
+	staticFields      map[string]interface{}
+	labels            map[string]string
+	sampleRate        int64
+	threshold         Severity
+	postMarshal       func([]byte) []byte
+	formatter         Formatter
+	errorHandler      func(error)
+	deadLetter        io.Writer
+	fatalSink         io.Writer
+	retries           int
+	backoff, maxWait  time.Duration
+}
+
+// SnapshotConfig returns the current JSON configuration, e.g. to restore it after a test.
+func SnapshotConfig() Config {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	extraFieldsMu.RLock()
+	defer extraFieldsMu.RUnlock()
+	return Config{
+		parseTrailer:           ParseTrailer,
+		splitEmbeddedStack:     SplitEmbeddedStack,
+		marshalLatency:         MarshalLatency,
+		eventID:                EventID,
+		includeHostIP:          HostIP,
+		fastMode:               FastMode,
+		levelText:              LevelText,
+		timestampNanos:         TimestampNanos,
+		stackDepth:             StackDepth,
+		base64BinaryMessages:   Base64BinaryMessages,
+		trackTransforms:        TrackTransforms,
+		normalizeWhitespace:    NormalizeWhitespace,
+		preserveNewlines:       PreserveNewlines,
+		sinceLast:              SinceLast,
+		goroutineCount:         GoroutineCount,
+		uptime:                 Uptime,
+		monotonicNanos:         MonotonicNanos,
+		reentrancyGuard:        ReentrancyGuard,
+		repanicAfterRecover:    RepanicAfterRecover,
+		sourceCode:             SourceCode,
+		stackAsLines:           StackAsLines,
+		parseNestedJSON:        ParseNestedJSON,
+		fallbackToStdJSON:      FallbackToStdJSON,
+		stackOrigin:            StackOrigin,
+		hasStack:               HasStack,
+		levelValue:             LevelValue,
+		parseInlineHost:        ParseInlineHost,
+		omitSourceHost:         OmitSourceHost,
+		esCompatTimestamps:     ESCompatTimestamps,
+		platform:               Platform,
+		duplicateKeyPolicy:     DuplicateKeyPolicy,
+		tagOverflowPolicy:      TagOverflowPolicy,
+		malformedLinePolicy:    MalformedLinePolicy,
+		unknownLineNumber:      UnknownLineNumber,
+		severityCase:           SeverityCase,
+		severityNumbering:      SeverityNumbering,
+		writerSwapPolicy:       WriterSwapPolicy,
+		truncatedLineLength:    TruncatedLineLength,
+		severityPrefixSearch:   SeverityPrefixSearch,
+		maxEventBytes:          MaxEventBytes,
+		maxStackBytes:          MaxStackBytes,
+		stackTopFrames:         StackTopFrames,
+		maxTags:                MaxTags,
+		maxNestedJSONBytes:     MaxNestedJSONBytes,
+		maxStackFrames:         MaxStackFrames,
+		maxFieldValueBytes:     MaxFieldValueBytes,
+		vEnabledLevel:          VEnabledLevel,
+		stringIntegersAbove:    StringIntegersAbove,
+		stackDedupWindow:       StackDedupWindow,
+		minTimestampResolution: MinTimestampResolution,
+		prettyAboveSeverity:    PrettyAboveSeverity,
+		goroutineCountSeverity: GoroutineCountSeverity,
+		plainMessageSeverity:   PlainMessageSeverity,
+		recoverSeverity:        RecoverSeverity,
+		severityInference:      severityInference,
+		eventIDGenerator:       eventIDGenerator,
+		stackPredicate:         stackPredicate,
+		levelNames:             levelNames,
+		customLevelNames:       copySeverityNames(customLevelNames),
+		alertThreshold:         alertThreshold,
+		severityOrdinals:       severityOrdinals,
+		severityScores:         severityScores,
+		fieldSeverities:        copyFieldSeverities(fieldSeverities),
+		fieldKinds:             copyFieldKinds(fieldKinds),
+		region:                 region,
+		zone:                   zone,
+		baseYear:               baseYear,
+		filePathPrefix:         filePathPrefix,
+		sourceRoot:             sourceRoot,
+		stackIndent:            StackIndent,
+		originSkip:             originSkipPrefixes,
+		fieldOrder:             fieldOrder,
+		fileFilter:             fileFilter,
+		fieldsKey:              fieldsKey,
+		fieldKeys:              FieldKeys{levelKey, threadidKey, fileKey, lineKey, stackKey},
+		rootWrapper:            rootWrapper,
+		syslogLineFields:       syslogLineFields,
+		severityIcons:          severityIcons,
+		hooks:                  append([]Hook{}, hooks...),
+		tagRules:               append([]tagRule{}, tagRules...),
+		extraFields:            copyExtraFields(ExtraFields),
+		extraValues:            copyExtraValues(extraValues),
+		staticFields:           copyExtraValues(staticFields),
+		labels:                 labels,
+		sampleRate:             atomic.LoadInt64(&sampleRate),
+		threshold:              logstash.threshold,
+		postMarshal:            logstash.postMarshal,
+		formatter:              formatter,
+		errorHandler:           errorHandler,
+		deadLetter:             deadLetter,
+		fatalSink:              fatalSink,
+		retries:                writeRetry.retries,
+		backoff:                writeRetry.backoff,
+		maxWait:                writeRetry.maxWait,
+	}
+}
+
+// RestoreConfig applies a configuration returned by SnapshotConfig.
+func RestoreConfig(c Config) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	ParseTrailer = c.parseTrailer
+	SplitEmbeddedStack = c.splitEmbeddedStack
+	MarshalLatency = c.marshalLatency
+	EventID = c.eventID
+	HostIP = c.includeHostIP
+	FastMode = c.fastMode
+	LevelText = c.levelText
+	TimestampNanos = c.timestampNanos
+	StackDepth = c.stackDepth
+	Base64BinaryMessages = c.base64BinaryMessages
+	TrackTransforms = c.trackTransforms
+	NormalizeWhitespace = c.normalizeWhitespace
+	PreserveNewlines = c.preserveNewlines
+	SinceLast = c.sinceLast
+	GoroutineCount = c.goroutineCount
+	Uptime = c.uptime
+	MonotonicNanos = c.monotonicNanos
+	ReentrancyGuard = c.reentrancyGuard
+	RepanicAfterRecover = c.repanicAfterRecover
+	SourceCode = c.sourceCode
+	StackAsLines = c.stackAsLines
+	ParseNestedJSON = c.parseNestedJSON
+	FallbackToStdJSON = c.fallbackToStdJSON
+	StackOrigin = c.stackOrigin
+	HasStack = c.hasStack
+	LevelValue = c.levelValue
+	ParseInlineHost = c.parseInlineHost
+	OmitSourceHost = c.omitSourceHost
+	ESCompatTimestamps = c.esCompatTimestamps
+	Platform = c.platform
+	DuplicateKeyPolicy = c.duplicateKeyPolicy
+	TagOverflowPolicy = c.tagOverflowPolicy
+	MalformedLinePolicy = c.malformedLinePolicy
+	UnknownLineNumber = c.unknownLineNumber
+	SeverityCase = c.severityCase
+	SeverityNumbering = c.severityNumbering
+	WriterSwapPolicy = c.writerSwapPolicy
+	TruncatedLineLength = c.truncatedLineLength
+	SeverityPrefixSearch = c.severityPrefixSearch
+	MaxEventBytes = c.maxEventBytes
+	MaxStackBytes = c.maxStackBytes
+	StackTopFrames = c.stackTopFrames
+	MaxTags = c.maxTags
+	MaxNestedJSONBytes = c.maxNestedJSONBytes
+	MaxStackFrames = c.maxStackFrames
+	MaxFieldValueBytes = c.maxFieldValueBytes
+	VEnabledLevel = c.vEnabledLevel
+	StringIntegersAbove = c.stringIntegersAbove
+	StackDedupWindow = c.stackDedupWindow
+	MinTimestampResolution = c.minTimestampResolution
+	PrettyAboveSeverity = c.prettyAboveSeverity
+	GoroutineCountSeverity = c.goroutineCountSeverity
+	PlainMessageSeverity = c.plainMessageSeverity
+	RecoverSeverity = c.recoverSeverity
+	severityInference = c.severityInference
+	eventIDGenerator = c.eventIDGenerator
+	stackPredicate = c.stackPredicate
+	levelNames = c.levelNames
+	customLevelNames = copySeverityNames(c.customLevelNames)
+	alertThreshold = c.alertThreshold
+	severityOrdinals = c.severityOrdinals
+	severityScores = c.severityScores
+	fieldSeverities = copyFieldSeverities(c.fieldSeverities)
+	fieldKinds = copyFieldKinds(c.fieldKinds)
+	region, zone = c.region, c.zone
+	baseYear = c.baseYear
+	filePathPrefix = c.filePathPrefix
+	sourceRoot = c.sourceRoot
+	StackIndent = c.stackIndent
+	originSkipPrefixes = c.originSkip
+	fieldOrder = c.fieldOrder
+	fileFilter = c.fileFilter
+	fieldsKey = c.fieldsKey
+	levelKey = keyOrDefault(c.fieldKeys.Level, "level")
+	threadidKey = keyOrDefault(c.fieldKeys.ThreadID, "threadid")
+	fileKey = keyOrDefault(c.fieldKeys.File, "file")
+	lineKey = keyOrDefault(c.fieldKeys.Line, "line")
+	stackKey = keyOrDefault(c.fieldKeys.Stack, "stack")
+	rootWrapper = c.rootWrapper
+	syslogLineFields = c.syslogLineFields
+	severityIcons = c.severityIcons
+	hooks = append([]Hook{}, c.hooks...)
+	tagRules = append([]tagRule{}, c.tagRules...)
+	extraFieldsMu.Lock()
+	ExtraFields = copyExtraFields(c.extraFields)
+	extraValues = copyExtraValues(c.extraValues)
+	staticFields = copyExtraValues(c.staticFields)
+	extraFieldsMu.Unlock()
+	labels = c.labels
+	atomic.StoreInt64(&sampleCount, 0)
+	atomic.StoreInt64(&sampleRate, c.sampleRate)
+	logstash.threshold = c.threshold
+	logstash.postMarshal = c.postMarshal
+	formatter = c.formatter
+	errorHandler = c.errorHandler
+	deadLetter = c.deadLetter
+	fatalSink = c.fatalSink
+	writeRetry.retries, writeRetry.backoff, writeRetry.maxWait = c.retries, c.backoff, c.maxWait
+}
+
+// The maps of a Config are copied such that later changes do not modify a snapshot.
+
+func copySeverityNames(m map[Severity]string) map[Severity]string {
+	c := make(map[Severity]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyFieldSeverities(m map[string]Severity) map[string]Severity {
+	c := make(map[string]Severity, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyFieldKinds(m map[string]FieldKind) map[string]FieldKind {
+	c := make(map[string]FieldKind, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyExtraFields(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyExtraValues(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
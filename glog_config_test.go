@@ -0,0 +1,58 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import "testing"
+
+// go test -v -test.run TestSnapshotConfig ...glog
+func TestSnapshotConfig(t *testing.T) {
+	original := SnapshotConfig()
+	defer RestoreConfig(original)
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] careful\n")
+
+	LevelText = true
+	SetSeverityName(WarningSeverity, "WARN")
+	ExtraFields["team"] = "payments"
+	snapshot := SnapshotConfig()
+
+	LevelText = false
+	SetSeverityName(WarningSeverity, "CAUTION")
+	ExtraFields["team"] = "search"
+	SetAlertThreshold(InfoSeverity)
+	buf, _ := WriteWithStack(line, nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if fields["level"] != "CAUTION" || fields["team"] != "search" || fields["alert"] != true {
+		t.Fatalf("expected the changed config, got %v", fields)
+	}
+
+	RestoreConfig(snapshot)
+	buf, _ = WriteWithStack(line, nil)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if fields["level"] != "WARN" || fields["level_text"] != "WARN" || fields["team"] != "payments" {
+		t.Errorf("expected the snapshot config, got %v", fields)
+	}
+	if _, ok := fields["alert"]; ok {
+		t.Error("expected no alert after restore")
+	}
+
+	RestoreConfig(original)
+	buf, _ = WriteWithStack(line, nil)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if fields["level"] != "WARNING" || fields["team"] != nil {
+		t.Errorf("expected the original config, got %v", fields)
+	}
+}
@@ -0,0 +1,125 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ecsEvent is an event in the Elastic Common Schema (ECS) layout.
+// ffjson: skip
+type ecsEvent struct {
+	Timestamp string                 `json:"@timestamp"`
+	Message   string                 `json:"message"`
+	Log       ecsLog                 `json:"log"`
+	Host      *ecsHost               `json:"host,omitempty"`
+	Process   *ecsProcess            `json:"process,omitempty"`
+	Error     *ecsError              `json:"error,omitempty"`
+	Glog      map[string]interface{} `json:"glog,omitempty"`
+}
+
+// ffjson: skip
+type ecsLog struct {
+	Level  interface{} `json:"level,omitempty"`
+	Origin *ecsOrigin  `json:"origin,omitempty"`
+}
+
+// ffjson: skip
+type ecsOrigin struct {
+	File ecsFile `json:"file"`
+}
+
+// ffjson: skip
+type ecsFile struct {
+	Name interface{} `json:"name,omitempty"`
+	Line interface{} `json:"line,omitempty"`
+}
+
+// ffjson: skip
+type ecsHost struct {
+	Name string `json:"name"`
+}
+
+// ffjson: skip
+type ecsProcess struct {
+	Thread struct {
+		ID int64 `json:"id"`
+	} `json:"thread"`
+}
+
+// ffjson: skip
+type ecsError struct {
+	StackTrace string `json:"stack_trace"`
+}
+
+// WriteWithStackECS decodes the data as WriteWithStack does and returns the event in the
+// Elastic Common Schema layout: the level becomes log.level, the file and line become
+// log.origin.file.name and log.origin.file.line, the host becomes host.name, the thread id
+// becomes process.thread.id and the stack becomes error.stack_trace. The other fields are
+// written in the glog object.
+func WriteWithStackECS(data []byte, stack []byte) ([]byte, error) {
+	log, _ := parseEvent(data, stack)
+	return json.Marshal(newECSEvent(log))
+}
+
+// newECSEvent returns the ECS layout of a decoded event.
+func newECSEvent(log *logJSON) *ecsEvent {
+	fields := make(map[string]interface{}, len(log.Fields))
+	for k, v := range log.Fields {
+		fields[k] = v
+	}
+	take := func(key string) (interface{}, bool) {
+		value, ok := fields[key]
+		delete(fields, key)
+		return value, ok
+	}
+	ecs := &ecsEvent{Timestamp: log.TimeStamp.Format(time.RFC3339Nano), Message: log.Message}
+	if ESCompatTimestamps {
+		ecs.Timestamp = log.TimeStamp.Format(esTimestampLayout)
+	}
+	ecs.Log.Level, _ = take(levelKey)
+	file, hasFile := take(fileKey)
+	line, hasLine := take(lineKey)
+	if hasFile || hasLine {
+		ecs.Log.Origin = &ecsOrigin{ecsFile{file, line}}
+	}
+	if !OmitSourceHost && log.SourceHost != "" {
+		ecs.Host = &ecsHost{log.SourceHost}
+	}
+	if threadid, ok := fields[threadidKey].(string); ok {
+		if id, err := strconv.ParseInt(threadid, 10, 64); err == nil {
+			delete(fields, threadidKey)
+			ecs.Process = new(ecsProcess)
+			ecs.Process.Thread.ID = id
+		}
+	}
+	switch trace := fields[stackKey].(type) {
+	case string:
+		ecs.Error = &ecsError{trace}
+		delete(fields, stackKey)
+	case []string:
+		ecs.Error = &ecsError{strings.Join(trace, "\n")}
+		delete(fields, stackKey)
+	}
+	if len(fields) > 0 {
+		ecs.Glog = fields
+	}
+	return ecs
+}
@@ -0,0 +1,59 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import "testing"
+
+// go test -v -test.run TestWriteWithStackECS ...glog
+func TestWriteWithStackECS(t *testing.T) {
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"role": "web"}
+	buf, err := WriteWithStackECS([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := decodeEvent(t, buf)
+	if event["message"] != "failed" || event["@timestamp"] == nil || event["@fields"] != nil {
+		t.Errorf("unexpected event %v", event)
+	}
+	path := func(keys ...string) interface{} {
+		var value interface{} = event
+		for _, each := range keys {
+			object, _ := value.(map[string]interface{})
+			value = object[each]
+		}
+		return value
+	}
+	for expected, keys := range map[interface{}][]string{
+		"ERROR":             {"log", "level"},
+		"a.go":              {"log", "origin", "file", "name"},
+		float64(10):         {"log", "origin", "file", "line"},
+		host:                {"host", "name"},
+		float64(12345):      {"process", "thread", "id"},
+		string(sampleStack): {"error", "stack_trace"},
+		"web":               {"glog", "role"},
+	} {
+		if got := path(keys...); got != expected {
+			t.Errorf("%v: expected %v, got %v", keys, expected, got)
+		}
+	}
+
+	buf, _ = WriteWithStackECS([]byte("plain message"), nil)
+	if event = decodeEvent(t, buf); event["error"] != nil || path("log", "origin") != nil || event["message"] != "plain message" {
+		t.Errorf("expected no error and origin for a plain message, got %v", event)
+	}
+}
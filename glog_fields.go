@@ -0,0 +1,296 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseTrailer moves the key=value pairs of a "[k1=v1, k2=v2]" message trailer into @fields.
+// Values are stored as int, float, bool or string. Keys of the fields that describe the severity,
+// source or stack of the event, e.g. level and file, are skipped such that a message cannot forge them.
+var ParseTrailer = false
+
+// KeyPolicy identifies how a key that occurs more than once in a message is decoded.
+type KeyPolicy int
+
+const (
+	LastWins      KeyPolicy = iota // the last value is kept
+	FirstWins                      // the first value is kept
+	CollectValues                  // all values are kept in an array
+)
+
+// DuplicateKeyPolicy is applied to keys that occur more than once in a message trailer, e.g. [k=1, k=2].
+var DuplicateKeyPolicy = LastWins
+
+// keyValue is a key=value token of a message.
+type keyValue struct {
+	key, value string
+}
+
+// decodeTrailer moves the key=value pairs of a trailer of the message into fields
+// and returns the message without the trailer.
+func decodeTrailer(message string, fields map[string]interface{}) string {
+	trimmed := strings.TrimRight(message, "\n")
+	if !strings.HasSuffix(trimmed, "]") {
+		return message
+	}
+	open := strings.LastIndex(trimmed, "[")
+	if open == -1 {
+		return message
+	}
+	pairs, ok := splitKeyValues(trimmed[open+1:len(trimmed)-1], ",")
+	if !ok {
+		return message
+	}
+	seen := map[string]bool{}
+	for _, each := range pairs {
+		if reservedKey(each.key) {
+			continue
+		}
+		value := inferValue(each.value)
+		if !seen[each.key] {
+			seen[each.key] = true
+			fields[each.key] = value
+			continue
+		}
+		switch DuplicateKeyPolicy {
+		case FirstWins:
+		case CollectValues:
+			if values, ok := fields[each.key].([]interface{}); ok {
+				fields[each.key] = append(values, value)
+			} else {
+				fields[each.key] = []interface{}{fields[each.key], value}
+			}
+		default:
+			fields[each.key] = value
+		}
+	}
+	return strings.TrimRight(trimmed[:open], " ")
+}
+
+// reservedKey returns whether the key is of a field that is set from the glog header, the severity or the stack.
+func reservedKey(key string) bool {
+	for _, each := range []string{levelKey, threadidKey, fileKey, lineKey, stackKey, threadNameKey,
+		levelTextKey, levelValueKey, levelOrdinalKey, alertKey, stackRefKey, hasStackKey, originKey} {
+		if key == each {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeyValues tokenizes the key=value pairs in s that are separated by sep.
+// It returns false if a token is not a key=value pair.
+func splitKeyValues(s, sep string) ([]keyValue, bool) {
+	pairs := []keyValue{}
+	for _, token := range strings.Split(s, sep) {
+		token = strings.TrimSpace(token)
+		eq := strings.IndexByte(token, '=')
+		if eq < 1 {
+			return nil, false
+		}
+		pairs = append(pairs, keyValue{token[:eq], token[eq+1:]})
+	}
+	return pairs, true
+}
+
+// inferValue returns the value as an int, float or bool if it can be parsed as one, or the string otherwise.
+func inferValue(value string) interface{} {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && finite(f) {
+		return f
+	}
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
+
+// finite returns whether the float can be encoded in JSON, i.e. is not NaN or infinite.
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// ParseNestedJSON replaces field values that are JSON objects encoded as a string,
+// e.g. by an upstream logger, by the decoded object. Values larger than MaxNestedJSONBytes
+// are kept as string; nested strings are decoded up to a depth of maxNestedJSONDepth.
+var ParseNestedJSON = false
+
+// MaxNestedJSONBytes is the maximum size of a string value decoded by ParseNestedJSON.
+var MaxNestedJSONBytes = 4096
+
+const maxNestedJSONDepth = 3
+
+// parseNestedJSON decodes the string values of the fields that are JSON objects.
+func parseNestedJSON(fields map[string]interface{}, depth int) {
+	if depth > maxNestedJSONDepth {
+		return
+	}
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok || len(s) < 2 || len(s) > MaxNestedJSONBytes || s[0] != '{' || s[len(s)-1] != '}' {
+			continue
+		}
+		nested := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(s), &nested); err != nil {
+			continue
+		}
+		parseNestedJSON(nested, depth+1)
+		fields[key] = nested
+	}
+}
+
+// FieldKind identifies the type a field is coerced to, see SetFieldType.
+type FieldKind int
+
+const (
+	AnyKind    FieldKind = iota // no coercion
+	StringKind                  // e.g. "42"
+	IntKind                     // e.g. 42
+	FloatKind                   // e.g. 42.0
+	BoolKind                    // true or false
+)
+
+// fieldKinds maps keys of @fields to the type their values are coerced to.
+var fieldKinds = map[string]FieldKind{}
+
+// SetFieldType makes the values of the field always have the kind, e.g. for a consistent
+// Elasticsearch mapping. Values are converted when possible (e.g. the string "42" to IntKind);
+// values that do not fit are dropped. Use AnyKind to remove the rule for the field.
+func SetFieldType(key string, kind FieldKind) {
+	logging.mu.Lock()
+	if kind == AnyKind {
+		delete(fieldKinds, key)
+	} else {
+		fieldKinds[key] = kind
+	}
+	logging.mu.Unlock()
+}
+
+// coerceFields converts or drops the fields that have a kind.
+func coerceFields(fields map[string]interface{}) {
+	for key, kind := range fieldKinds {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if coerced, ok := coerceValue(value, kind); ok {
+			fields[key] = coerced
+		} else {
+			delete(fields, key)
+		}
+	}
+}
+
+// coerceValue returns the value converted to the kind or false if it does not fit.
+// NaN and infinite floats do not fit because JSON cannot encode them.
+func coerceValue(value interface{}, kind FieldKind) (interface{}, bool) {
+	switch kind {
+	case StringKind:
+		if s, ok := value.(string); ok {
+			return s, true
+		}
+		return fmt.Sprint(value), true
+	case IntKind:
+		switch v := value.(type) {
+		case int:
+			return int64(v), true
+		case int64:
+			return v, true
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), true
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, true
+			}
+		}
+	case FloatKind:
+		switch v := value.(type) {
+		case int:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		case float64:
+			return v, finite(v)
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && finite(f) {
+				return f, true
+			}
+		}
+	case BoolKind:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// StringIntegersAbove renders integer field values with a larger magnitude as strings, e.g. 64-bit IDs,
+// such that consumers that parse JSON numbers as float64 do not lose precision. 1<<53 is the largest
+// magnitude such consumers represent exactly. Zero disables the rendering.
+var StringIntegersAbove uint64 = 0
+
+// stringifyIntegers replaces the integer values of the fields that exceed StringIntegersAbove by strings.
+func stringifyIntegers(fields map[string]interface{}) {
+	for key, value := range fields {
+		var magnitude uint64
+		switch v := value.(type) {
+		case int:
+			magnitude = absInt64(int64(v))
+		case int32:
+			magnitude = absInt64(int64(v))
+		case int64:
+			magnitude = absInt64(v)
+		case uint:
+			magnitude = uint64(v)
+		case uint32:
+			magnitude = uint64(v)
+		case uint64:
+			magnitude = v
+		default:
+			continue
+		}
+		if magnitude > StringIntegersAbove {
+			fields[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// absInt64 returns the magnitude of v, also for math.MinInt64.
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
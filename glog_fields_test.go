@@ -0,0 +1,193 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// go test -v -test.run TestParseTrailer ...glog
+func TestParseTrailer(t *testing.T) {
+	ParseTrailer = true
+	defer func() { ParseTrailer = false }()
+	buf, err := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] request done [status=200, ratio=0.75, cached=true, user=ernest]\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := decodeEvent(t, buf)
+	if got := event["message"]; got != "request done" {
+		t.Errorf("expected message without trailer, got %q", got)
+	}
+	fields := eventFields(t, event)
+	for key, expected := range map[string]interface{}{
+		"status": float64(200),
+		"ratio":  0.75,
+		"cached": true,
+		"user":   "ernest",
+	} {
+		if got := fields[key]; got != expected {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", key, expected, expected, got, got)
+		}
+	}
+	if got := inferValue("200"); got != int64(200) {
+		t.Errorf("expected int64 200, got %v (%T)", got, got)
+	}
+	// JSON has no NaN or infinity
+	for _, each := range []string{"NaN", "Inf", "-inf", "1e999"} {
+		if got := inferValue(each); got != each {
+			t.Errorf("expected string %q, got %v (%T)", each, got, got)
+		}
+	}
+}
+
+// go test -v -test.run TestParseTrailerReservedKeys ...glog
+func TestParseTrailerReservedKeys(t *testing.T) {
+	ParseTrailer = true
+	defer func() { ParseTrailer = false }()
+	buf := mustWrite(t, []byte("I0102 15:04:05.678901 12345 a.go:10] user input [level=FATAL, file=evil.go, line=1, user=ernest]\n"))
+	fields := eventFields(t, decodeEvent(t, buf))
+	for key, expected := range map[string]interface{}{
+		"level": "INFO",
+		"file":  "a.go",
+		"line":  float64(10),
+		"user":  "ernest",
+	} {
+		if got := fields[key]; got != expected {
+			t.Errorf("%s: expected %v, got %v", key, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestParseTrailerNoPairs ...glog
+func TestParseTrailerNoPairs(t *testing.T) {
+	ParseTrailer = true
+	defer func() { ParseTrailer = false }()
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] list [a, b]\n"), nil)
+	if got := decodeEvent(t, buf)["message"]; got != "list [a, b]" {
+		t.Errorf("expected message unchanged, got %q", got)
+	}
+}
+
+// go test -v -test.run TestDuplicateKeyPolicy ...glog
+func TestDuplicateKeyPolicy(t *testing.T) {
+	ParseTrailer = true
+	defer func() {
+		ParseTrailer = false
+		DuplicateKeyPolicy = LastWins
+	}()
+	for policy, expected := range map[KeyPolicy]interface{}{
+		LastWins:      float64(3),
+		FirstWins:     float64(1),
+		CollectValues: []interface{}{float64(1), float64(2), float64(3)},
+	} {
+		DuplicateKeyPolicy = policy
+		buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] retry [k=1, k=2, k=3]\n"), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["k"]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("policy %d: expected %v, got %v", policy, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestSetFieldType ...glog
+func TestSetFieldType(t *testing.T) {
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"build": "42", "port": "http"}
+	SetFieldType("build", IntKind)
+	SetFieldType("port", IntKind)
+	SetFieldType("line", StringKind)
+	defer func() {
+		SetFieldType("build", AnyKind)
+		SetFieldType("port", AnyKind)
+		SetFieldType("line", AnyKind)
+	}()
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if got := fields["build"]; got != float64(42) {
+		t.Errorf("expected build coerced to number 42, got %#v", got)
+	}
+	if got, ok := fields["port"]; ok {
+		t.Errorf("expected non-numeric port to be dropped, got %#v", got)
+	}
+	if got := fields["line"]; got != "10" {
+		t.Errorf("expected line coerced to string, got %#v", got)
+	}
+}
+
+// go test -v -test.run TestCoerceFloatNotFinite ...glog
+func TestCoerceFloatNotFinite(t *testing.T) {
+	for _, each := range []interface{}{"NaN", " +Inf", math.NaN(), math.Inf(-1)} {
+		if got, ok := coerceValue(each, FloatKind); ok {
+			t.Errorf("%v: expected no fit, got %v", each, got)
+		}
+	}
+	if got, ok := coerceValue("0.5", FloatKind); !ok || got != 0.5 {
+		t.Errorf("expected 0.5, got %v", got)
+	}
+}
+
+// go test -v -test.run TestParseNestedJSON ...glog
+func TestParseNestedJSON(t *testing.T) {
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{
+		"upstream": `{"user":"ernest","request":"{\"id\":7}"}`,
+		"large":    `{"data":"` + strings.Repeat("x", 100) + `"}`,
+		"broken":   `{"user":`,
+	}
+	ParseNestedJSON = true
+	MaxNestedJSONBytes = 64
+	defer func() {
+		ParseNestedJSON = false
+		MaxNestedJSONBytes = 4096
+	}()
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	expected := map[string]interface{}{"user": "ernest", "request": map[string]interface{}{"id": float64(7)}}
+	if got := fields["upstream"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected nested objects %v, got %v", expected, got)
+	}
+	if _, ok := fields["large"].(string); !ok {
+		t.Errorf("expected a too large value kept as string, got %v", fields["large"])
+	}
+	if got := fields["broken"]; got != `{"user":` {
+		t.Errorf("expected invalid JSON kept as string, got %v", got)
+	}
+}
+
+// go test -v -test.run TestStringIntegersAbove ...glog
+func TestStringIntegersAbove(t *testing.T) {
+	ParseTrailer = true
+	StringIntegersAbove = 1 << 53
+	defer func() {
+		ParseTrailer = false
+		StringIntegersAbove = 0
+	}()
+	buf := mustWrite(t, []byte("I0102 15:04:05.678901 12345 a.go:10] stored [id=9007199254740993, neg=-9223372036854775808, count=42]\n"))
+	fields := eventFields(t, decodeEvent(t, buf))
+	for key, expected := range map[string]interface{}{
+		"id":    "9007199254740993",
+		"neg":   "-9223372036854775808",
+		"count": float64(42),
+		"line":  float64(10),
+	} {
+		if got := fields[key]; got != expected {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", key, expected, expected, got, got)
+		}
+	}
+}
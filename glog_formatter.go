@@ -0,0 +1,133 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Entry is a decoded glog line, independent of the wire format.
+// ffjson: skip
+type Entry struct {
+	Severity   Severity
+	Level      string // the level field; empty for a plain message
+	Timestamp  time.Time
+	SourceHost string
+	ThreadID   string
+	File       string
+	Line       *int // nil if unknown, see UnknownLineNumber
+	Message    string
+	Stack      []byte
+	Fields     map[string]interface{} // the extra and optional fields
+}
+
+// Formatter encodes an Entry, e.g. as logstash json, ECS or an internal schema.
+type Formatter interface {
+	Format(entry *Entry) ([]byte, error)
+}
+
+// formatter encodes the events if set; nil means the logstash json encoding.
+var formatter Formatter
+
+// SetFormatter sets the Formatter that encodes each event for the Logstash writer, the JSON sinks
+// and WriteWithStack, which decode each line once into an Entry. Formatted events are not pretty
+// printed nor reduced to MaxEventBytes. Pass nil to restore the logstash json encoding.
+func SetFormatter(f Formatter) {
+	logging.mu.Lock()
+	formatter = f
+	logging.mu.Unlock()
+}
+
+// newEntry returns the Entry of a decoded event.
+func newEntry(log *logJSON, sev Severity) *Entry {
+	fields := make(map[string]interface{}, len(log.Fields))
+	for k, v := range log.Fields {
+		fields[k] = v
+	}
+	entry := &Entry{
+		Severity:   sev,
+		Timestamp:  log.TimeStamp,
+		SourceHost: log.SourceHost,
+		Message:    log.Message,
+		Fields:     fields,
+	}
+	entry.Level, _ = fields[levelKey].(string)
+	entry.ThreadID, _ = fields[threadidKey].(string)
+	entry.File, _ = fields[fileKey].(string)
+	if line, ok := fields[lineKey].(int); ok {
+		entry.Line = &line
+	}
+	switch trace := fields[stackKey].(type) {
+	case string:
+		entry.Stack = []byte(trace)
+	case []string:
+		entry.Stack = []byte(strings.Join(trace, "\n"))
+	}
+	for _, each := range []string{levelKey, threadidKey, fileKey, lineKey, stackKey} {
+		delete(fields, each)
+	}
+	return entry
+}
+
+// event returns the logstash json event of the entry.
+func (e *Entry) event() *logJSON {
+	log := &logJSON{SourceHost: e.SourceHost, TimeStamp: e.Timestamp, Message: e.Message}
+	log.Fields = make(map[string]interface{}, len(e.Fields)+5)
+	for k, v := range e.Fields {
+		log.Fields[k] = v
+	}
+	if e.Level != "" {
+		log.Fields[levelKey] = e.Level
+	}
+	if e.ThreadID != "" {
+		log.Fields[threadidKey] = e.ThreadID
+	}
+	if e.File != "" {
+		log.Fields[fileKey] = e.File
+		if e.Line != nil {
+			log.Fields[lineKey] = *e.Line
+		} else if UnknownLineNumber == NullLineNumber {
+			log.Fields[lineKey] = nil
+		}
+	}
+	if len(e.Stack) > 0 { // already indented
+		if StackAsLines {
+			log.Fields[stackKey] = strings.Split(strings.TrimSuffix(string(e.Stack), "\n"), "\n")
+		} else {
+			log.Fields[stackKey] = string(e.Stack)
+		}
+	}
+	return log
+}
+
+// LogstashFormatter encodes entries as logstash json events, the default.
+type LogstashFormatter struct{}
+
+// Format is part of the Formatter interface.
+func (LogstashFormatter) Format(entry *Entry) ([]byte, error) {
+	return marshal(entry.event())
+}
+
+// ECSFormatter encodes entries in the Elastic Common Schema layout, see WriteWithStackECS.
+type ECSFormatter struct{}
+
+// Format is part of the Formatter interface.
+func (ECSFormatter) Format(entry *Entry) ([]byte, error) {
+	return json.Marshal(newECSEvent(entry.event()))
+}
@@ -0,0 +1,106 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// lineFormatter encodes entries in an internal text schema.
+type lineFormatter struct {
+	entries []*Entry
+}
+
+func (l *lineFormatter) Format(entry *Entry) ([]byte, error) {
+	l.entries = append(l.entries, entry)
+	line := 0
+	if entry.Line != nil {
+		line = *entry.Line
+	}
+	return []byte(fmt.Sprintf("%s|%s|%s:%d|%s|%d", entry.Level, entry.ThreadID, entry.File, line, entry.Message, len(entry.Stack))), nil
+}
+
+// go test -v -test.run TestSetFormatter ...glog
+func TestSetFormatter(t *testing.T) {
+	defer SetFormatter(nil)
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"role": "web"}
+	custom := new(lineFormatter)
+	SetFormatter(custom)
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] failed\n")
+
+	buf, err := WriteWithStack(line, sampleStack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("ERROR|12345|a.go:10|failed|%d", len(sampleStack)); string(buf) != expected {
+		t.Errorf("expected %q, got %q", expected, buf)
+	}
+	entry := custom.entries[0]
+	if entry.Severity != ErrorSeverity || entry.Fields["role"] != "web" || entry.Fields["level"] != nil {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// the Logstash writer uses the formatter too
+	defer func(previous *bufferedWriter) { logstash.writer = previous }(logstash.writer)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	logstash.WriteWithStack(line, nil)
+	logstash.flush()
+	if got := capture.String(); got != "ERROR|12345|a.go:10|failed|0\n" {
+		t.Errorf("expected the formatted event, got %q", got)
+	}
+}
+
+// go test -v -test.run TestLogstashFormatter ...glog
+func TestLogstashFormatter(t *testing.T) {
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] same\n")
+	standard := decodeEvent(t, mustWrite(t, line))
+
+	defer SetFormatter(nil)
+	SetFormatter(LogstashFormatter{})
+	formatted := decodeEvent(t, mustWrite(t, line))
+	if !reflect.DeepEqual(formatted, standard) {
+		t.Errorf("expected\n%v\ngot\n%v", standard, formatted)
+	}
+
+	SetFormatter(ECSFormatter{})
+	ecs := decodeEvent(t, mustWrite(t, line))
+	if log, _ := ecs["log"].(map[string]interface{}); log["level"] != "WARNING" || ecs["message"] != "same" {
+		t.Errorf("expected an ECS event, got %v", ecs)
+	}
+}
+
+// go test -v -test.run TestLogstashFormatterUnknownLine ...glog
+func TestLogstashFormatterUnknownLine(t *testing.T) {
+	defer func() { UnknownLineNumber = ZeroLineNumber }()
+	defer SetFormatter(nil)
+	line := []byte("W0102 15:04:05.678901 12345 a.go:x] unknown line\n")
+	for _, policy := range []LineNumberPolicy{ZeroLineNumber, NullLineNumber, OmitLineNumber} {
+		UnknownLineNumber = policy
+		SetFormatter(nil)
+		standard := decodeEvent(t, mustWrite(t, line))
+		SetFormatter(LogstashFormatter{})
+		formatted := decodeEvent(t, mustWrite(t, line))
+		if !reflect.DeepEqual(formatted, standard) {
+			t.Errorf("policy %d: expected\n%v\ngot\n%v", policy, standard, formatted)
+		}
+	}
+}
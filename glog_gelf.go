@@ -0,0 +1,95 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// GELFWriter decodes each glog line written to it and writes the event in the
+// Graylog Extended Log Format (GELF 1.1). Messages are terminated by a null byte,
+// as expected by a GELF TCP input.
+type GELFWriter struct {
+	writer io.Writer
+}
+
+// NewGELFWriter returns a GELFWriter that writes events to w.
+// Use it as the writer of an EventFormat Sink to receive the decoded events.
+func NewGELFWriter(w io.Writer) *GELFWriter {
+	return &GELFWriter{w}
+}
+
+// Write is for implementing io.Writer. It decodes the glog line into an Event.
+func (g *GELFWriter) Write(data []byte) (n int, err error) {
+	log, sev := parseEvent(data, nil)
+	if err := g.writeEvent((*Event)(log), sev); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteEvent writes the GELF encoding of the event. The syslog level is derived from its level field.
+func (g *GELFWriter) WriteEvent(event *Event) error {
+	return g.writeEvent(event, severityOfEvent(event))
+}
+
+func (g *GELFWriter) writeEvent(event *Event, sev Severity) error {
+	buf, err := json.Marshal(gelfMessage(event, sev))
+	if err != nil {
+		return err
+	}
+	_, err = g.writer.Write(append(buf, 0))
+	return err
+}
+
+// gelfMessage maps an event to the GELF fields. Fields become additional fields,
+// prefixed by an underscore; the reserved id is not allowed and is written as _id_.
+func gelfMessage(event *Event, sev Severity) map[string]interface{} {
+	gelf := make(map[string]interface{}, len(event.Fields)+6)
+	for k, v := range event.Fields {
+		if k == "id" {
+			k = "id_"
+		}
+		gelf["_"+k] = v
+	}
+	gelf["version"] = "1.1"
+	gelf["host"] = event.SourceHost
+	gelf["timestamp"] = float64(event.TimeStamp.UnixNano()/1e3) / 1e6 // seconds with microseconds
+	gelf["level"] = syslogLevel(sev)
+	short := strings.TrimRight(event.Message, "\n")
+	if i := strings.IndexByte(short, '\n'); i != -1 {
+		short = short[:i]
+		gelf["full_message"] = event.Message
+	}
+	gelf["short_message"] = short
+	return gelf
+}
+
+// syslogLevel returns the syslog number of a severity; custom severities are informational.
+func syslogLevel(sev Severity) int {
+	switch sev {
+	case FatalSeverity:
+		return 2 // critical
+	case ErrorSeverity:
+		return 3
+	case WarningSeverity:
+		return 4
+	}
+	return 6
+}
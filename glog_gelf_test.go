@@ -0,0 +1,75 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// go test -v -test.run TestGELFWriter ...glog
+func TestGELFWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	writer := NewGELFWriter(out)
+	if _, err := writer.Write([]byte("W0102 15:04:05.678901 12345 a.go:10] disk almost full\nused 95%\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte{0}) {
+		t.Fatalf("expected a null byte terminated message, got %q", out.String())
+	}
+	gelf := map[string]interface{}{}
+	if err := json.Unmarshal(bytes.TrimSuffix(out.Bytes(), []byte{0}), &gelf); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": "disk almost full",
+		"full_message":  "disk almost full\nused 95%",
+		"level":         float64(4),
+		"_level":        "WARNING",
+		"_file":         "a.go",
+		"_line":         float64(10),
+		"_threadid":     "12345",
+	} {
+		if got := gelf[key]; got != expected {
+			t.Errorf("%s: expected %v, got %v", key, expected, got)
+		}
+	}
+	if _, ok := gelf["timestamp"].(float64); !ok {
+		t.Errorf("expected a numeric timestamp, got %v", gelf["timestamp"])
+	}
+}
+
+// go test -v -test.run TestGELFSyslogLevel ...glog
+func TestGELFSyslogLevel(t *testing.T) {
+	for sev, expected := range map[Severity]float64{InfoSeverity: 6, WarningSeverity: 4, ErrorSeverity: 3, FatalSeverity: 2} {
+		out := new(bytes.Buffer)
+		if err := NewGELFWriter(out).WriteEvent(NewEvent(sev, "hello", nil)); err != nil {
+			t.Fatal(err)
+		}
+		gelf := map[string]interface{}{}
+		json.Unmarshal(bytes.TrimSuffix(out.Bytes(), []byte{0}), &gelf)
+		if got := gelf["level"]; got != expected {
+			t.Errorf("%v: expected level %v, got %v", sev, expected, got)
+		}
+		if _, ok := gelf["full_message"]; ok {
+			t.Errorf("%v: expected no full_message for a single line", sev)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"sync"
+	"time"
+)
+
+// periodic runs a function every interval in a goroutine until it is stopped.
+type periodic struct {
+	sync.Mutex
+	stop chan bool
+	done chan bool
+}
+
+// heartbeat and statsSummary write their events periodically.
+var heartbeat, statsSummary periodic
+
+var after = time.After // Stubbed out for testing.
+
+// start runs the function every interval; it replaces a running function.
+func (p *periodic) start(interval time.Duration, f func()) {
+	p.stopAndWait()
+	stop, done := make(chan bool), make(chan bool)
+	p.Lock()
+	p.stop, p.done = stop, done
+	p.Unlock()
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-after(interval):
+				f()
+			}
+		}
+	}()
+}
+
+// stopAndWait stops the function and waits until it is done; it does nothing if none is running.
+func (p *periodic) stopAndWait() {
+	p.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// StartHeartbeat writes an INFO event with heartbeat:true to the Logstash writer every interval,
+// such that collectors that alert on missing logs do not alert for a quiet process.
+// Heartbeats are not subject to the logstash threshold and sampling, and have no file, line and threadid.
+// Each heartbeat flushes the buffered events while holding the lock of the logging configuration, so
+// logging waits for a slow writer then. It replaces a running heartbeat.
+func StartHeartbeat(interval time.Duration) {
+	heartbeat.start(interval, writeHeartbeat)
+}
+
+// StopHeartbeat stops the heartbeat and waits until it is done; it does nothing if none is running.
+func StopHeartbeat() {
+	heartbeat.stopAndWait()
+}
+
+// writeHeartbeat publishes and flushes a heartbeat event.
+func writeHeartbeat() {
+	logging.mu.Lock()
+	if logstash.enabled() {
+		exit := enterPublishing()
+		log := newProcessEvent("heartbeat")
+		log.Fields[heartbeatKey] = true
+		logstash.publish([]byte("heartbeat\n"), log, InfoSeverity)
+		logstash.flush()
+		exit()
+	}
+	logging.mu.Unlock()
+}
+
+// newProcessEvent returns an INFO event about the process rather than a call site,
+// so without the file, line and threadid of a glog header.
+func newProcessEvent(message string) *logJSON {
+	log := &logJSON{Fields: make(map[string]interface{}), Message: message}
+	addStaticInfo(log)
+	log.Fields[levelKey] = levelName(InfoSeverity)
+	if !FastMode {
+		addExtraFields(log.Fields)
+		addOptionalInfo(log, InfoSeverity, nil)
+	}
+	return log
+}
+
+// lastSummary holds the Stats lines and the time of the previous summary event.
+// It is only used by the summary goroutine, after StartStatsSummary.
+var lastSummary struct {
+	lines [numSeverity]int64
+	at    time.Time
+}
+
+// StartStatsSummary writes an INFO event with type:"log_stats" to the Logstash writer every interval,
+// with the number of INFO, WARNING and ERROR lines (see Stats) since the previous summary and the
+// length of that period in period_ms, for when the counters cannot be scraped as metrics.
+// Summaries are not subject to the logstash threshold and sampling, and have no file, line and threadid.
+// Like a heartbeat, each summary flushes the buffered events while holding the lock of the logging
+// configuration. It replaces a running summary.
+func StartStatsSummary(interval time.Duration) {
+	statsSummary.stopAndWait()
+	lastSummary.lines = statsLines()
+	lastSummary.at = timeNow()
+	statsSummary.start(interval, writeStatsSummary)
+}
+
+// StopStatsSummary stops the summary events and waits until it is done; it does nothing if none is running.
+func StopStatsSummary() {
+	statsSummary.stopAndWait()
+}
+
+// statsLines returns the current number of lines per severity.
+func statsLines() (lines [numSeverity]int64) {
+	for sev, stats := range severityStats {
+		if stats != nil {
+			lines[sev] = stats.Lines()
+		}
+	}
+	return
+}
+
+// writeStatsSummary publishes and flushes a summary event with the counts since the previous one.
+func writeStatsSummary() {
+	lines, now := statsLines(), timeNow()
+	logging.mu.Lock()
+	if logstash.enabled() {
+		exit := enterPublishing()
+		log := newProcessEvent("log stats")
+		log.Fields[typeKey] = "log_stats"
+		log.Fields[infoLinesKey] = lines[infoLog] - lastSummary.lines[infoLog]
+		log.Fields[warningLinesKey] = lines[warningLog] - lastSummary.lines[warningLog]
+		log.Fields[errorLinesKey] = lines[errorLog] - lastSummary.lines[errorLog]
+		log.Fields[periodKey] = int64(now.Sub(lastSummary.at) / time.Millisecond)
+		logstash.publish([]byte("log stats\n"), log, InfoSeverity)
+		logstash.flush()
+		exit()
+	}
+	logging.mu.Unlock()
+	lastSummary.lines, lastSummary.at = lines, now
+}
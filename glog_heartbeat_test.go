@@ -0,0 +1,109 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// go test -v -test.run TestHeartbeat ...glog
+func TestHeartbeat(t *testing.T) {
+	defer func(previous func(time.Duration) <-chan time.Time) { after = previous }(after)
+	ticks := make(chan time.Time)
+	after = func(time.Duration) <-chan time.Time { return ticks }
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+
+	StartHeartbeat(time.Minute)
+	ticks <- time.Now()
+	ticks <- time.Now()
+	StopHeartbeat()
+	StopHeartbeat() // no longer running
+
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 heartbeats, got %d", len(events))
+	}
+	for _, each := range events {
+		fields := eventFields(t, each)
+		if each["message"] != "heartbeat" || fields["heartbeat"] != true || fields["level"] != "INFO" {
+			t.Errorf("unexpected heartbeat %v", each)
+		}
+		for _, key := range []string{"file", "line", "threadid"} {
+			if _, ok := fields[key]; ok {
+				t.Errorf("expected no %s, got %v", key, fields[key])
+			}
+		}
+	}
+}
+
+// go test -v -test.run TestStatsSummary ...glog
+func TestStatsSummary(t *testing.T) {
+	defer func(previous func(time.Duration) <-chan time.Time) { after = previous }(after)
+	ticks := make(chan time.Time)
+	after = func(time.Duration) <-chan time.Time { return ticks }
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	clock := make(chan time.Time, 1)
+	clock <- now
+	timeNow = func() time.Time {
+		current := <-clock
+		clock <- current
+		return current
+	}
+	advance := func(d time.Duration) { clock <- (<-clock).Add(d) }
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+
+	StartStatsSummary(time.Minute)
+	atomic.AddInt64(&Stats.Info.lines, 3)
+	atomic.AddInt64(&Stats.Error.lines, 1)
+	advance(time.Minute)
+	ticks <- time.Now()
+	atomic.AddInt64(&Stats.Warning.lines, 2)
+	advance(30 * time.Second)
+	ticks <- time.Now()
+	StopStatsSummary()
+
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(events))
+	}
+	for i, expected := range []map[string]interface{}{
+		{"type": "log_stats", "info_lines": float64(3), "warning_lines": float64(0), "error_lines": float64(1), "period_ms": float64(60000)},
+		{"type": "log_stats", "info_lines": float64(0), "warning_lines": float64(2), "error_lines": float64(0), "period_ms": float64(30000)},
+	} {
+		fields := eventFields(t, events[i])
+		for key, value := range expected {
+			if fields[key] != value {
+				t.Errorf("summary %d: expected %s %v, got %v", i, key, value, fields[key])
+			}
+		}
+		for _, key := range []string{"file", "line", "threadid"} {
+			if _, ok := fields[key]; ok {
+				t.Errorf("summary %d: expected no %s, got %v", i, key, fields[key])
+			}
+		}
+	}
+}
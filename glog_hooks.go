@@ -0,0 +1,51 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+// Hook transforms events before they are encoded, e.g. to redact secrets or enrich fields.
+type Hook interface {
+	// Name identifies the hook in the _transforms field.
+	Name() string
+	// Apply modifies the event and returns whether it changed anything.
+	Apply(event *Event) bool
+}
+
+// hooks are applied in order for each event.
+var hooks []Hook
+
+// AddHook appends a hook that is applied to each event, before the tag rules.
+func AddHook(hook Hook) {
+	logging.mu.Lock()
+	hooks = append(hooks, hook)
+	logging.mu.Unlock()
+}
+
+// TrackTransforms adds the _transforms array with the names of the hooks that modified the event.
+var TrackTransforms = false
+
+// applyHooks applies all hooks to the event.
+func applyHooks(log *logJSON) {
+	var applied []string
+	for _, each := range hooks {
+		if each.Apply((*Event)(log)) && TrackTransforms {
+			applied = append(applied, each.Name())
+		}
+	}
+	if len(applied) > 0 {
+		log.Fields[transformsKey] = applied
+	}
+}
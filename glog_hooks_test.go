@@ -0,0 +1,75 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// redactHook replaces a secret in the message.
+type redactHook struct{}
+
+func (redactHook) Name() string { return "redact" }
+
+func (redactHook) Apply(event *Event) bool {
+	if !strings.Contains(event.Message, "secret") {
+		return false
+	}
+	event.Message = strings.Replace(event.Message, "secret", "******", -1)
+	return true
+}
+
+// teamHook adds a field to every event.
+type teamHook struct{}
+
+func (teamHook) Name() string { return "team" }
+
+func (teamHook) Apply(event *Event) bool {
+	event.Fields["team"] = "payments"
+	return true
+}
+
+// go test -v -test.run TestTrackTransforms ...glog
+func TestTrackTransforms(t *testing.T) {
+	defer func() { hooks = nil }()
+	AddHook(redactHook{})
+	AddHook(teamHook{})
+	TrackTransforms = true
+	defer func() { TrackTransforms = false }()
+
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] password is secret\n"), nil)
+	event := decodeEvent(t, buf)
+	if got := event["message"]; got != "password is ******" {
+		t.Errorf("expected redacted message, got %v", got)
+	}
+	if got := eventFields(t, event)["_transforms"]; !reflect.DeepEqual(got, []interface{}{"redact", "team"}) {
+		t.Errorf("expected both transforms, got %v", got)
+	}
+
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["_transforms"]; !reflect.DeepEqual(got, []interface{}{"team"}) {
+		t.Errorf("expected only the team transform, got %v", got)
+	}
+
+	TrackTransforms = false
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["_transforms"]; ok {
+		t.Error("expected no _transforms when disabled")
+	}
+}
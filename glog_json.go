@@ -17,8 +17,24 @@
 package glog
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 /*
@@ -35,33 +51,896 @@ import (
 }
 */
 type logJSON struct {
-	SourceHost string                 `json:"@source_host"`
-	TimeStamp  time.Time              `json:"@timestamp"`
-	Fields     map[string]interface{} `json:"@fields"`
-	Message    string                 `json:"message"`
+	SourceHost string                 `json:"@source_host" msgpack:"@source_host"`
+	TimeStamp  time.Time              `json:"@timestamp" msgpack:"@timestamp"`
+	Fields     map[string]interface{} `json:"@fields" msgpack:"@fields"`
+	Message    string                 `json:"message" msgpack:"message"`
+}
+
+// Event is a decoded glog line with the same fields as the logstash json event.
+// ffjson: skip
+type Event logJSON
+
+// NewEvent returns an Event for a structured message, without a glog line.
+// The fields are copied into @fields together with the level and the ExtraFields.
+func NewEvent(sev Severity, msg string, fields map[string]interface{}) *Event {
+	log := &logJSON{Fields: make(map[string]interface{}, len(fields)+2)}
+	addStaticInfo(log)
+	log.Message = msg
+	log.Fields[levelKey] = levelName(sev)
+	if !FastMode {
+		addExtraFields(log.Fields)
+	}
+	for k, v := range fields {
+		log.Fields[k] = v
+	}
+	if !FastMode {
+		addOptionalInfo(log, sev, nil)
+	}
+	return (*Event)(log)
+}
+
+// Marshal returns the logstash json representation of the event.
+func (e *Event) Marshal() ([]byte, error) {
+	return marshal((*logJSON)(e))
 }
 
 // WriteWithStack decodes the data and writes a logstash json event
 func WriteWithStack(data []byte, stack []byte) ([]byte, error) {
+	return encodeEvent(parseEvent(data, stack))
+}
+
+// TruncatedLineLength is the maximum length of a line written by the logging source, e.g. 30000
+// for the C++ glog. Lines of that length without a line delimiter were truncated by the source
+// and get the source_truncated field. Zero disables the detection.
+var TruncatedLineLength = 0
+
+// parseEvent decodes the data and stack into a logJSON and returns it with its severity.
+func parseEvent(data []byte, stack []byte) (*logJSON, Severity) {
 	logJSON := &logJSON{Fields: make(map[string]interface{})}
 	addStaticInfo(logJSON)
 
+	if TruncatedLineLength > 0 && len(data) >= TruncatedLineLength && data[len(data)-1] != 10 {
+		logJSON.Fields[sourceTruncatedKey] = true
+	}
+
+	if severityInference != nil {
+		if sev, ok := severityInference(data); ok {
+			logJSON.Fields[levelKey] = levelName(sev)
+			logJSON.Message = string(data)
+			if !FastMode {
+				addOptionalInfo(logJSON, sev, stack)
+			}
+			return logJSON, sev
+		}
+	}
+
+	if SplitEmbeddedStack && stack == nil {
+		data, stack = splitEmbeddedStack(data)
+	}
+
 	// peek for normal logline
-	sev := data[0]
+	data = skipExternalPrefix(data)
+	var sev byte // stays zero for data that is too short for a header, e.g. empty
+	if len(data) >= iwefHeaderLength {
+		sev = data[0]
+	}
 	switch sev {
 	case 73, 87, 69, 70: // IWEF
-		iwefJSON(sev, data, stack, logJSON)
+		if MinTimestampResolution > 0 && !FastMode {
+			checkTimestampResolution(data)
+		}
+		iwefJSON(sev, data, logJSON)
+		if len(stack) > 0 {
+			if FastMode || stackPredicate == nil || stackPredicate((*Event)(logJSON)) {
+				addStack(logJSON, stack)
+			} else {
+				stack = nil
+			}
+		}
 	default:
 		logJSON.Message = string(data)
 	}
+	if !FastMode {
+		addOptionalInfo(logJSON, severityOf(sev), stack)
+	}
+	return logJSON, severityOf(sev)
+}
+
+// MinTimestampResolution is the expected resolution of the header timestamps, e.g. time.Microsecond.
+// If consecutive headers have a coarser timestamp, e.g. ".000000" when only seconds are written,
+// a one-time warning is reported to the error handler because the order of events may be coarse.
+// Zero disables the check.
+var MinTimestampResolution = time.Duration(0)
+
+// lowResolutionRun is the number of headers that must be coarser in a row, such that
+// a timestamp that ends with zeros by chance does not report the warning.
+const lowResolutionRun = 10
+
+// lowResolutionHeaders counts the consecutive coarse headers; lowResolutionWarned is 1 after
+// the warning. Handled atomically.
+var lowResolutionHeaders, lowResolutionWarned int32
+
+// checkTimestampResolution reports a warning once if the headers are coarser than MinTimestampResolution.
+func checkTimestampResolution(data []byte) {
+	if timestampResolution(data) <= MinTimestampResolution {
+		atomic.StoreInt32(&lowResolutionHeaders, 0)
+		return
+	}
+	if atomic.AddInt32(&lowResolutionHeaders, 1) >= lowResolutionRun &&
+		atomic.CompareAndSwapInt32(&lowResolutionWarned, 0, 1) {
+		errorHandler(fmt.Errorf("header timestamps have a lower resolution than %v, e.g. %q; the order of events may be coarse",
+			MinTimestampResolution, data[1:21]))
+	}
+}
+
+// timestampResolution returns the resolution of the header timestamp, derived from
+// the trailing zeros of its microseconds; time.Second if it has no microseconds.
+func timestampResolution(data []byte) time.Duration {
+	if len(data) < 21 || data[14] != '.' || !isDigits(data[15:21]) {
+		return time.Second
+	}
+	micros, _ := strconv.Atoi(string(data[15:21]))
+	resolution := time.Microsecond
+	for micros%10 == 0 && resolution < time.Second {
+		micros /= 10
+		resolution *= 10
+	}
+	return resolution
+}
+
+// VEnabledLevel adds the v_enabled field, which tells whether V(VEnabledLevel) is enabled by
+// the -v or -vmodule flag for the file of the event when it is written, e.g. to debug the
+// verbosity configuration. Zero omits the field.
+var VEnabledLevel = Level(0)
+
+// vEnabled returns whether the -v or -vmodule flag enables the level for the file, as V does.
+func vEnabled(file string, level Level) bool {
+	if logging.verbosity.get() >= level {
+		return true
+	}
+	module := strings.TrimSuffix(filepath.Base(file), ".go")
+	for _, filter := range logging.vmodule.filter {
+		if filter.match(module) {
+			return filter.level >= level
+		}
+	}
+	return false
+}
+
+// ParseInlineHost takes the @source_host of an event from an "@host=name " prefix of its message,
+// e.g. for applications that log for several tenants. The prefix is removed from the message.
+var ParseInlineHost = false
+
+const inlineHostMarker = "@host="
+
+// inlineHost returns the host of an inline host prefix of the message and the message without it.
+func inlineHost(message string) (string, string, bool) {
+	if !strings.HasPrefix(message, inlineHostMarker) {
+		return "", message, false
+	}
+	end := strings.IndexAny(message, " \t\n")
+	if end == -1 {
+		end = len(message)
+	}
+	name := message[len(inlineHostMarker):end]
+	if name == "" {
+		return "", message, false
+	}
+	return name, strings.TrimLeft(message[end:], " \t"), true
+}
+
+// iwefHeaderLength is the length of the "Lmmdd hh:mm:ss.uuuuuu " part of a glog header;
+// shorter data is a plain message.
+const iwefHeaderLength = 22
+
+// SplitEmbeddedStack moves a goroutine trace that is part of the data (starting with
+// a "goroutine N [running]:" line) to the stack field, if no stack is given.
+var SplitEmbeddedStack = false
+
+var embeddedStackMarker = regexp.MustCompile(`goroutine \d+ \[running\]:`)
+
+// splitEmbeddedStack returns the data before an embedded trace and the trace, or the data and nil.
+func splitEmbeddedStack(data []byte) ([]byte, []byte) {
+	where := embeddedStackMarker.FindIndex(data)
+	if where == nil || where[0] == 0 { // keep a trace without message as is
+		return data, nil
+	}
+	return bytes.TrimRight(data[:where[0]], " \t\r\n"), data[where[0]:]
+}
+
+// encodeEvent returns the JSON representation of a decoded event.
+func encodeEvent(logJSON *logJSON, sev Severity) ([]byte, error) {
+	var start time.Time
+	if MarshalLatency {
+		start = timeNow()
+	}
+	var buf []byte
+	var err error
+	if formatter != nil {
+		buf, err = formatter.Format(newEntry(logJSON, sev))
+	} else {
+		buf, err = marshal(logJSON)
+	}
+	if MarshalLatency {
+		marshalLatency.add(timeNow().Sub(start))
+	}
+	if formatter != nil { // not necessarily JSON
+		return buf, err
+	}
+	if err == nil && MaxEventBytes > 0 && len(buf) > MaxEventBytes {
+		buf, err = reduceEvent(logJSON, buf)
+	}
+	if err != nil || sev <= PrettyAboveSeverity || sev > FatalSeverity { // only glog severities
+		return buf, err
+	}
+	// the indentation must not exceed the maximum size
+	if pretty := indentJSON(buf); MaxEventBytes <= 0 || len(pretty) <= MaxEventBytes {
+		return pretty, nil
+	}
+	return buf, nil
+}
+
+// MarshalLatency measures the time spent encoding each event, see MarshalLatencyStats.
+var MarshalLatency = false
+
+// LatencyStats summarizes the measured durations.
+// ffjson: skip
+type LatencyStats struct {
+	Count         int64
+	Min, Max, Avg time.Duration
+}
+
+// latencyStats accumulates durations under a lock.
+// ffjson: skip
+type latencyStats struct {
+	mu       sync.Mutex
+	count    int64
+	min, max time.Duration
+	total    time.Duration
+}
+
+var marshalLatency = new(latencyStats)
+
+// add records a duration.
+func (l *latencyStats) add(d time.Duration) {
+	l.mu.Lock()
+	if l.count == 0 || d < l.min {
+		l.min = d
+	}
+	if d > l.max {
+		l.max = d
+	}
+	l.count++
+	l.total += d
+	l.mu.Unlock()
+}
+
+// summary returns the stats of the recorded durations.
+func (l *latencyStats) summary() LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := LatencyStats{Count: l.count, Min: l.min, Max: l.max}
+	if l.count > 0 {
+		s.Avg = l.total / time.Duration(l.count)
+	}
+	return s
+}
 
-	return logJSON.MarshalJSON()
+// MarshalLatencyStats returns the min, max and average time spent encoding events
+// since MarshalLatency was enabled.
+func MarshalLatencyStats() LatencyStats {
+	return marshalLatency.summary()
+}
+
+// PrettyAboveSeverity is the severity above which events of the glog severities are indented,
+// e.g. to make crash details readable on a console; custom severities are never indented. By default no event is indented. Indented events
+// span several lines; ParseEvents reads them. An event is not indented if that exceeds MaxEventBytes.
+var PrettyAboveSeverity = FatalSeverity
+
+// indentJSON returns the indented form of a JSON event or the event itself if that fails.
+func indentJSON(buf []byte) []byte {
+	pretty := new(bytes.Buffer)
+	if err := json.Indent(pretty, buf, "", "  "); err != nil {
+		return buf
+	}
+	return pretty.Bytes()
+}
+
+// WriteLines decodes each newline-delimited glog line in data and returns a logstash json event per line.
+// A trailing line without a line delimiter is decoded as well. The stack is added to the last event only.
+func WriteLines(data []byte, stack []byte) ([][]byte, error) {
+	events := [][]byte{}
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, 10)
+		var line []byte
+		if end == -1 {
+			// partial line; add the delimiter the decoder expects
+			line = append(append([]byte{}, data...), 10)
+			data = nil
+		} else {
+			line = data[:end+1]
+			data = data[end+1:]
+		}
+		var trace []byte
+		if len(data) == 0 {
+			trace = stack
+		}
+		buf, err := WriteWithStack(line, trace)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, buf)
+	}
+	return events, nil
+}
+
+// PeekSeverityAndSize returns the severity and the length of glog data without decoding it,
+// e.g. for a metrics sink that counts events without marshalling them.
+// Plain messages get the PlainMessageSeverity.
+func PeekSeverityAndSize(data []byte) (Severity, int) {
+	return peekSeverity(data), len(data)
+}
+
+// peekSeverity returns the severity of a glog data packet without decoding it.
+// Plain messages get the PlainMessageSeverity.
+func peekSeverity(data []byte) Severity {
+	if severityInference != nil {
+		if sev, ok := severityInference(data); ok {
+			return sev
+		}
+	}
+	data = skipExternalPrefix(data)
+	if len(data) < iwefHeaderLength {
+		return PlainMessageSeverity
+	}
+	return severityOf(data[0])
+}
+
+// severityInference is the optional user function that determines the severity of custom formats.
+var severityInference func(data []byte) (Severity, bool)
+
+// SetSeverityInference sets a function that is asked first for the severity of each line.
+// If it returns ok then that severity is used and the line is not parsed as glog (IWEF) format;
+// the whole line becomes the message. Otherwise the built-in detection applies. Pass nil to remove it.
+func SetSeverityInference(infer func(data []byte) (Severity, bool)) {
+	logging.mu.Lock()
+	severityInference = infer
+	logging.mu.Unlock()
+}
+
+// severityOf returns the severity for an IWEF byte. Other bytes get the PlainMessageSeverity.
+func severityOf(sev byte) Severity {
+	switch sev {
+	case 73:
+		return InfoSeverity
+	case 87:
+		return WarningSeverity
+	case 69:
+		return ErrorSeverity
+	case 70:
+		return FatalSeverity
+	}
+	return PlainMessageSeverity
+}
+
+// levelNames holds the value of the level field per severity.
+var levelNames = [numSeverity]string{
+	infoLog:    "INFO",
+	warningLog: "WARNING",
+	errorLog:   "ERROR",
+	fatalLog:   "FATAL",
+}
+
+// customLevelNames holds the value of the level field for severities beyond the glog ones,
+// e.g. those returned by a severity inference function.
+var customLevelNames = map[Severity]string{}
+
+// LetterCase identifies how the level field is written.
+type LetterCase int
+
+const (
+	UpperCase LetterCase = iota // e.g. WARNING
+	TitleCase                   // e.g. Warning
+	LowerCase                   // e.g. warning
+)
+
+// SeverityCase is the letter case of the level field.
+var SeverityCase = UpperCase
+
+// LevelValue adds the level_value field with the number of the severity, see SeverityNumbering.
+var LevelValue = false
+
+// Numbering identifies how the level_value field numbers the severities.
+type Numbering int
+
+const (
+	InternalNumbering Numbering = iota // 0=info, 1=warning, 2=error, 3=fatal
+	SyslogNumbering                    // 6=info, 4=warning, 3=error, 2=critical
+)
+
+// SeverityNumbering is the numbering of the level_value field.
+var SeverityNumbering = InternalNumbering
+
+// levelValue returns the value of the level_value field for a severity.
+func levelValue(sev Severity) int {
+	if SeverityNumbering == SyslogNumbering {
+		return syslogLevel(sev)
+	}
+	return int(sev)
+}
+
+// levelName returns the value of the level field for a severity.
+func levelName(sev Severity) string {
+	var name string
+	if sev >= 0 && int(sev) < len(levelNames) {
+		name = levelNames[sev]
+	} else if custom, ok := customLevelNames[sev]; ok {
+		name = custom
+	} else {
+		name = sev.String()
+	}
+	switch SeverityCase {
+	case TitleCase:
+		if len(name) > 0 {
+			return strings.ToUpper(name[:1]) + strings.ToLower(name[1:])
+		}
+	case LowerCase:
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// SetSeverityName changes the value of the level field for events of a severity, e.g. "ERR" for ErrorSeverity.
+// Other than the glog severities, it also names custom ones, e.g. Severity(5) as "NOTICE".
+func SetSeverityName(sev Severity, name string) {
+	logging.mu.Lock()
+	if sev >= 0 && int(sev) < len(levelNames) {
+		levelNames[sev] = name
+	} else {
+		customLevelNames[sev] = name
+	}
+	logging.mu.Unlock()
+}
+
+// EventID adds a unique event_id to each event, a random (version 4) UUID unless
+// another generator is set by SetEventIDGenerator.
+var EventID = false
+
+// eventIDGenerator returns the value of the event_id field.
+var eventIDGenerator = newUUID
+
+// SetEventIDGenerator sets the function that returns the event_id of each event, e.g. a ULID.
+// Pass nil to restore the UUID generator.
+func SetEventIDGenerator(generator func() string) {
+	if generator == nil {
+		generator = newUUID
+	}
+	logging.mu.Lock()
+	eventIDGenerator = generator
+	logging.mu.Unlock()
+}
+
+// newUUID returns a random UUID in the canonical form.
+func newUUID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return ""
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40 // version 4
+	uuid[8] = uuid[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// NoAlert is the alert threshold that no event reaches; it is the default.
+const NoAlert = Severity(math.MaxInt32)
+
+// alertThreshold is the minimum severity of events that get the alert field.
+var alertThreshold = NoAlert
+
+// SetAlertThreshold adds alert:true to events at or above the severity, for downstream routing.
+// Custom severities are compared by their position in the order set by SetSeverityOrder;
+// without one, only the glog severities get the field. Pass NoAlert to remove the field.
+func SetAlertThreshold(threshold Severity) {
+	logging.mu.Lock()
+	alertThreshold = threshold
+	logging.mu.Unlock()
+}
+
+// alerted returns whether the severity is at or above the alert threshold. The values of
+// custom severities have no order, so their positions in the severity order are compared.
+func alerted(sev Severity) bool {
+	ordinal, ok := severityOrdinals[sev]
+	threshold, thresholdOk := severityOrdinals[alertThreshold]
+	if ok && thresholdOk {
+		return ordinal >= threshold
+	}
+	return sev >= alertThreshold && sev <= FatalSeverity
+}
+
+// severityOrdinals maps severities to their position in the order set by SetSeverityOrder.
+var severityOrdinals map[Severity]int
+
+// SetSeverityOrder adds a level_ordinal field with the position (from 0) of the event severity
+// in the order, e.g. to sort events of a custom severity set. Severities not in the order
+// get no ordinal. Pass no severities to remove the field.
+func SetSeverityOrder(order ...Severity) {
+	var ordinals map[Severity]int
+	if len(order) > 0 {
+		ordinals = make(map[Severity]int, len(order))
+		for i, each := range order {
+			ordinals[each] = i
+		}
+	}
+	logging.mu.Lock()
+	severityOrdinals = ordinals
+	logging.mu.Unlock()
+}
+
+// SeverityPrefixSearch is the number of leading bytes searched for the start of
+// a glog header, for lines that are prefixed by an external system
+// (e.g. "2024-01-01 I0102 ..."). Zero means the header must start at the first byte.
+var SeverityPrefixSearch = 0
+
+// skipExternalPrefix returns the data starting at the glog header ([IWEF]mmdd followed by a space)
+// if found within the first SeverityPrefixSearch bytes. Otherwise it returns the data unchanged.
+func skipExternalPrefix(data []byte) []byte {
+	for p := 1; p < SeverityPrefixSearch && p+5 < len(data); p++ {
+		if !isSpace(data[p-1]) || !isSpace(data[p+5]) {
+			continue
+		}
+		switch data[p] {
+		case 73, 87, 69, 70: // IWEF
+			if isDigits(data[p+1 : p+5]) {
+				return data[p:]
+			}
+		}
+	}
+	return data
+}
+
+// isDigits returns whether all bytes are ASCII digits.
+func isDigits(data []byte) bool {
+	for _, each := range data {
+		if each < 48 || each > 57 {
+			return false
+		}
+	}
+	return true
 }
 
 // openEvent writes the "header" part of the JSON message.
 func addStaticInfo(log *logJSON) {
 	log.SourceHost = host
 	log.TimeStamp = timeNow()
+	if Platform && !FastMode {
+		log.Fields[osKey] = runtime.GOOS
+		log.Fields[archKey] = runtime.GOARCH
+	}
+}
+
+// Platform adds the os and arch fields with the operating system and architecture
+// of the process, e.g. "linux" and "amd64". They are optional, so not added in FastMode.
+var Platform = false
+
+// region and zone identify the deployment location; empty values are omitted.
+var region, zone = os.Getenv("CLOUD_REGION"), os.Getenv("CLOUD_ZONE")
+
+// SetRegion adds region and zone fields with the deployment location of the process.
+// An empty value falls back to the CLOUD_REGION or CLOUD_ZONE environment variable, which is also
+// used if SetRegion is not called. Fields that remain empty are omitted.
+func SetRegion(deploymentRegion, deploymentZone string) {
+	if deploymentRegion == "" {
+		deploymentRegion = os.Getenv("CLOUD_REGION")
+	}
+	if deploymentZone == "" {
+		deploymentZone = os.Getenv("CLOUD_ZONE")
+	}
+	logging.mu.Lock()
+	region, zone = deploymentRegion, deploymentZone
+	logging.mu.Unlock()
+}
+
+// HostIP adds the first non-loopback IPv4 address of the host to @fields.
+var HostIP = false
+
+// hostIP is resolved once at init; it is empty if no address was found.
+var hostIP = ""
+
+var interfaceAddrs = net.InterfaceAddrs // Stubbed out for testing.
+
+func init() {
+	hostIP = lookupHostIP()
+}
+
+// lookupHostIP returns the first non-loopback IPv4 address of the host, if any.
+func lookupHostIP() string {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, each := range addrs {
+		ipnet, ok := each.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// FastMode skips all optional @fields elements, including ExtraFields, such that
+// only the core fields of an event are decoded and encoded. It also skips sampling, the file
+// filter, the timestamp resolution check and the stack predicate; a given stack is always added.
+var FastMode = false
+
+// LevelText adds a copy of the level field as level_text, see FORK.md for the mapping.
+var LevelText = false
+
+// TimestampNanos adds the @timestamp as Unix nanoseconds to @fields, for precise sorting.
+var TimestampNanos = false
+
+// StackDepth adds the number of frames of the stack to @fields.
+var StackDepth = false
+
+// Base64BinaryMessages encodes messages with non-printable content in base64
+// and adds the message_encoding field, instead of replacing invalid UTF-8.
+var Base64BinaryMessages = false
+
+// isBinary returns whether the message has invalid UTF-8 or control characters other than whitespace.
+func isBinary(message string) bool {
+	if !utf8.ValidString(message) {
+		return true
+	}
+	for _, each := range message {
+		if unicode.IsControl(each) && each != 9 && each != 10 && each != 13 {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeWhitespace collapses runs of whitespace in the message to single spaces and trims its ends.
+var NormalizeWhitespace = false
+
+// PreserveNewlines keeps the line breaks of multi-line messages when NormalizeWhitespace is set.
+var PreserveNewlines = false
+
+// normalizeWhitespace returns the message with collapsed and trimmed whitespace.
+func normalizeWhitespace(message string) string {
+	if !PreserveNewlines {
+		return strings.Join(strings.Fields(message), " ")
+	}
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	for i, each := range lines {
+		lines[i] = strings.Join(strings.Fields(each), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SinceLast adds the milliseconds since the previous event to @fields.
+var SinceLast = false
+
+// GoroutineCount adds the number of goroutines to @fields of events at or above GoroutineCountSeverity.
+var GoroutineCount = false
+
+// GoroutineCountSeverity limits the overhead of GoroutineCount to severe events.
+var GoroutineCountSeverity = ErrorSeverity
+
+// Uptime adds the milliseconds since the start of the process to @fields.
+var Uptime = false
+
+// startTime is captured at init to compute the uptime.
+var startTime = timeNow()
+
+// MonotonicNanos adds the mono_ns field with the nanoseconds on the monotonic clock since
+// the start of the process. Unlike @timestamp it never goes back, e.g. after an NTP adjustment,
+// and it is strictly increasing so events can be ordered.
+var MonotonicNanos = false
+
+// monoStart is the monotonic clock reading captured at init; it is not affected by timeNow.
+var monoStart = time.Now()
+
+// lastMonoNanos is the mono_ns of the previous event. Handled atomically.
+var lastMonoNanos int64
+
+// nextMonoNanos returns the elapsed nanoseconds since monoStart, at least one more than the previous.
+func nextMonoNanos() int64 {
+	now := int64(time.Since(monoStart))
+	for {
+		previous := atomic.LoadInt64(&lastMonoNanos)
+		next := now
+		if next <= previous {
+			next = previous + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastMonoNanos, previous, next) {
+			return next
+		}
+	}
+}
+
+// lastEventNanos is the Unix nanoseconds of the previous event. Handled atomically.
+var lastEventNanos int64
+
+// severityScores maps severities to the value of the score field.
+var severityScores map[Severity]int
+
+// SetSeverityScores adds a score field to events with the weight of their severity, for alerting.
+// Severities that are not mapped get no score. Pass nil to remove the field.
+func SetSeverityScores(scores map[Severity]int) {
+	logging.mu.Lock()
+	severityScores = scores
+	logging.mu.Unlock()
+}
+
+// fieldSeverities maps keys of @fields to the minimum severity of events that include them.
+var fieldSeverities = map[string]Severity{}
+
+// IncludeOnSeverity limits a field, e.g. goroutines, uptime_ms or code, to events at or above
+// the severity to control cost. It applies to any field, including ExtraFields; fields that are
+// expensive to compute are not computed for other events.
+func IncludeOnSeverity(field string, minSev Severity) {
+	logging.mu.Lock()
+	fieldSeverities[field] = minSev
+	logging.mu.Unlock()
+}
+
+// included returns whether the field is not limited to more severe events.
+func included(field string, sev Severity) bool {
+	min, ok := fieldSeverities[field]
+	return !ok || sev >= min
+}
+
+// excludeFields removes the fields that are limited to more severe events.
+func excludeFields(fields map[string]interface{}, sev Severity) {
+	for key := range fieldSeverities {
+		if !included(key, sev) {
+			delete(fields, key)
+		}
+	}
+}
+
+// addOptionalInfo adds the @fields elements that are enabled by configuration.
+func addOptionalInfo(log *logJSON, sev Severity, stack []byte) {
+	if ParseInlineHost {
+		if name, message, ok := inlineHost(log.Message); ok {
+			log.SourceHost, log.Message = name, message
+		}
+	}
+	if ParseTrailer {
+		log.Message = decodeTrailer(log.Message, log.Fields)
+	}
+	if ParseNestedJSON {
+		parseNestedJSON(log.Fields, 1)
+	}
+	if Base64BinaryMessages && isBinary(log.Message) {
+		log.Message = base64.StdEncoding.EncodeToString([]byte(log.Message))
+		log.Fields[messageEncodingKey] = "base64"
+	} else if NormalizeWhitespace {
+		log.Message = normalizeWhitespace(log.Message)
+	}
+	if LevelText {
+		if level, ok := log.Fields[levelKey]; ok {
+			log.Fields[levelTextKey] = level
+		}
+	}
+	if LevelValue {
+		log.Fields[levelValueKey] = levelValue(sev)
+	}
+	if TimestampNanos {
+		log.Fields[tsNanosKey] = log.TimeStamp.UnixNano()
+	}
+	if HostIP && hostIP != "" {
+		log.Fields[hostIPKey] = hostIP
+	}
+	if StackDepth && len(stack) > 0 && included(stackDepthKey, sev) {
+		frames, truncated := parseStackFrames(stack)
+		log.Fields[stackDepthKey] = len(frames)
+		if truncated {
+			log.Fields[stackFramesTruncatedKey] = true
+		}
+	}
+	if StackOrigin && len(stack) > 0 {
+		if origin, ok := stackOrigin(stack); ok {
+			log.Fields[originKey] = origin
+		}
+	}
+	if VEnabledLevel > 0 {
+		if file, ok := log.Fields[fileKey].(string); ok {
+			log.Fields[vEnabledKey] = vEnabled(file, VEnabledLevel)
+		}
+	}
+	if HasStack {
+		log.Fields[hasStackKey] = len(stack) > 0
+	}
+	if SinceLast {
+		now := timeNow().UnixNano()
+		if previous := atomic.SwapInt64(&lastEventNanos, now); previous != 0 {
+			log.Fields[sinceLastKey] = (now - previous) / int64(time.Millisecond)
+		}
+	}
+	if score, ok := severityScores[sev]; ok {
+		log.Fields[scoreKey] = score
+	}
+	if region != "" {
+		log.Fields[regionKey] = region
+	}
+	if zone != "" {
+		log.Fields[zoneKey] = zone
+	}
+	if EventID {
+		log.Fields[eventIDKey] = eventIDGenerator()
+	}
+	if alerted(sev) {
+		log.Fields[alertKey] = true
+	}
+	if ordinal, ok := severityOrdinals[sev]; ok {
+		log.Fields[levelOrdinalKey] = ordinal
+	}
+	if GoroutineCount && sev >= GoroutineCountSeverity && included(goroutinesKey, sev) {
+		log.Fields[goroutinesKey] = runtime.NumGoroutine()
+	}
+	if SourceCode && included(codeKey, sev) {
+		file, _ := log.Fields[fileKey].(string)
+		line, _ := log.Fields[lineKey].(int)
+		if code, ok := sourceLine(file, line); ok {
+			log.Fields[codeKey] = code
+		}
+	}
+	if MonotonicNanos {
+		log.Fields[monoNanosKey] = nextMonoNanos()
+	}
+	if Uptime {
+		log.Fields[uptimeKey] = int64(timeNow().Sub(startTime) / time.Millisecond)
+	}
+	if len(hooks) > 0 {
+		applyHooks(log)
+	}
+	if len(fieldSeverities) > 0 {
+		excludeFields(log.Fields, sev)
+	}
+	if len(fieldKinds) > 0 {
+		coerceFields(log.Fields)
+	}
+	if StringIntegersAbove > 0 {
+		stringifyIntegers(log.Fields)
+	}
+	if MaxFieldValueBytes > 0 {
+		limitFieldValues(log.Fields)
+	}
+	// tag rules see all other fields
+	if len(tagRules) > 0 {
+		addTags(log)
+	}
+}
+
+// FieldKeys holds the keys of the @fields elements decoded from each glog line,
+// e.g. Level "severity" and ThreadID "thread_id" for an ingestion pipeline. See SetFieldKeys.
+// ffjson: skip
+type FieldKeys struct {
+	Level, ThreadID, File, Line, Stack string
+}
+
+// SetFieldKeys changes the keys of the level, threadid, file, line and stack fields,
+// typically once at startup. An empty key restores the default name.
+func SetFieldKeys(keys FieldKeys) {
+	logging.mu.Lock()
+	levelKey = keyOrDefault(keys.Level, "level")
+	threadidKey = keyOrDefault(keys.ThreadID, "threadid")
+	fileKey = keyOrDefault(keys.File, "file")
+	lineKey = keyOrDefault(keys.Line, "line")
+	stackKey = keyOrDefault(keys.Stack, "stack")
+	logging.mu.Unlock()
+}
+
+// keyOrDefault returns the key or the default name if it is empty.
+func keyOrDefault(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key
 }
 
 var levelKey = "level"
@@ -69,47 +948,171 @@ var threadidKey = "threadid"
 var fileKey = "file"
 var lineKey = "line"
 var stackKey = "stack"
+var tsNanosKey = "ts_nanos"
+var stackDepthKey = "stack_depth"
+var hostIPKey = "host_ip"
+var sinceLastKey = "since_last_ms"
+var messageEncodingKey = "message_encoding"
+var sampleRateKey = "sample_rate"
+var tagsKey = "tags"
+var sourceTruncatedKey = "source_truncated"
+var uptimeKey = "uptime_ms"
+var levelTextKey = "level_text"
+var levelValueKey = "level_value"
+var scoreKey = "score"
+var levelOrdinalKey = "level_ordinal"
+var regionKey = "region"
+var zoneKey = "zone"
+var stackRefKey = "stack_ref"
+var monoNanosKey = "mono_ns"
+var eventBytesKey = "event_bytes"
+var transformsKey = "_transforms"
+var threadNameKey = "thread_name"
+var alertKey = "alert"
+var eventIDKey = "event_id"
+var heartbeatKey = "heartbeat"
+var typeKey = "type"
+var infoLinesKey = "info_lines"
+var warningLinesKey = "warning_lines"
+var errorLinesKey = "error_lines"
+var periodKey = "period_ms"
+var stackFramesTruncatedKey = "stack_frames_truncated"
+var originKey = "origin"
+var hasStackKey = "has_stack"
+var vEnabledKey = "v_enabled"
+var osKey = "os"
+var archKey = "arch"
+var goroutinesKey = "goroutines"
+var codeKey = "code"
+var stackTopKey = "stack_top"
+var stackTruncatedBytesKey = "stack_truncated_bytes"
+
+// filePathPrefix is removed from the file of each event.
+var filePathPrefix = ""
+
+// SetFilePathPrefixStrip sets the prefix (e.g. "/home/ci/go/src/") that is removed from the file of each event.
+// Files that do not start with the prefix are unchanged.
+func SetFilePathPrefixStrip(prefix string) {
+	logging.mu.Lock()
+	filePathPrefix = prefix
+	logging.mu.Unlock()
+}
 
 // iwefJSON decodes a glog data packet and write the JSON representation.
 // [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg
-func iwefJSON(sev byte, data []byte, trace []byte, log *logJSON) {
-	switch sev {
-	case 73:
-		log.Fields[levelKey] = "INFO"
-	case 87:
-		log.Fields[levelKey] = "WARNING"
-	case 69:
-		log.Fields[levelKey] = "ERROR"
-	case 70:
-		log.Fields[levelKey] = "FATAL"
+// If the header is malformed, the message is the raw data.
+func iwefJSON(sev byte, data []byte, log *logJSON) {
+	if timestamp, ok := headerTime(data); ok {
+		log.TimeStamp = timestamp
 	}
-	r := &iwefreader{data, 22} // past last u
+	log.Fields[levelKey] = levelName(severityOf(sev))
+	r := &iwefreader{data: data, position: 22} // past last u
+	r.skipAllSpace()
+	log.Fields[threadidKey] = r.stringUpToSpace()
 	r.skipAllSpace()
-	log.Fields[threadidKey] = r.stringUpTo(32)
-	r.skip() // space
-	log.Fields[fileKey] = r.stringUpTo(58)
+	if name, ok := r.threadName(); ok {
+		log.Fields[threadNameKey] = name
+		r.skipAllSpace()
+	}
+	file := r.stringUpToLast(58, 93) // file may contain a colon, e.g. C:\foo\bar.go
+	if filePathPrefix != "" {
+		file = strings.TrimPrefix(file, filePathPrefix)
+	}
+	log.Fields[fileKey] = file
 	r.skip() // :
-	log.Fields[lineKey], _ = strconv.Atoi(r.stringUpTo(93))
+	if line, err := strconv.Atoi(r.stringUpTo(93)); err == nil {
+		log.Fields[lineKey] = line
+	} else if UnknownLineNumber == NullLineNumber {
+		log.Fields[lineKey] = nil
+	} else if UnknownLineNumber == ZeroLineNumber {
+		log.Fields[lineKey] = 0
+	}
 	// ]
 	r.skip()
-	// space
+	// space or tab
 	r.skip()
-	if trace != nil && len(trace) > 0 {
-		log.Fields[stackKey] = string(trace)
-	}
 	// extras?
-	for k, v := range ExtraFields {
-		log.Fields[k] = v
+	if !FastMode {
+		addExtraFields(log.Fields)
 	}
 	// fields
+	if r.failed { // malformed header, e.g. of a truncated packet
+		for _, each := range []string{threadidKey, threadNameKey, fileKey, lineKey} {
+			delete(log.Fields, each)
+		}
+		log.Message = string(data)
+		return
+	}
 	log.Message = r.stringUpToLineEnd()
 }
 
-// iwefreader is a small helper object to parse a glog IWEF entry
+// baseYear is the year of the header timestamps, which have no year; zero means the current year.
+var baseYear = 0
+
+// SetBaseYear sets the year of the timestamps read from glog headers, e.g. when processing
+// old log files. Pass 0 to use the current year, the default.
+func SetBaseYear(year int) {
+	logging.mu.Lock()
+	baseYear = year
+	logging.mu.Unlock()
+}
+
+// headerTime returns the local time of the mmdd hh:mm:ss.uuuuuu header timestamp.
+// Without a base year, a December header read in January is of the previous year.
+func headerTime(data []byte) (time.Time, bool) {
+	if len(data) < 21 || data[8] != ':' || data[11] != ':' || data[14] != '.' ||
+		!isDigits(data[1:5]) || !isSpace(data[5]) || !isDigits(data[6:8]) ||
+		!isDigits(data[9:11]) || !isDigits(data[12:14]) || !isDigits(data[15:21]) {
+		return time.Time{}, false
+	}
+	month, day := time.Month(digitsValue(data[1:3])), digitsValue(data[3:5])
+	hour, min, sec := digitsValue(data[6:8]), digitsValue(data[9:11]), digitsValue(data[12:14])
+	if month < time.January || month > time.December || hour > 23 || min > 59 || sec > 59 {
+		return time.Time{}, false
+	}
+	year := baseYear
+	if year == 0 {
+		now := timeNow()
+		year = now.Year()
+		if month > now.Month()+1 { // logged last year
+			year--
+		}
+	}
+	timestamp := time.Date(year, month, day, hour, min, sec, digitsValue(data[15:21])*1000, time.Local)
+	if timestamp.Day() != day { // e.g. 0230
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// digitsValue returns the number of ASCII digits.
+func digitsValue(digits []byte) int {
+	value := 0
+	for _, each := range digits {
+		value = value*10 + int(each-'0')
+	}
+	return value
+}
+
+// LineNumberPolicy identifies how a line number that cannot be parsed is written.
+type LineNumberPolicy int
+
+const (
+	ZeroLineNumber LineNumberPolicy = iota // "line":0, as a real line 0
+	NullLineNumber                         // "line":null
+	OmitLineNumber                         // no line field
+)
+
+// UnknownLineNumber is applied when the line of the glog header is not a number.
+var UnknownLineNumber = ZeroLineNumber
+
+// iwefreader is a small helper object to parse a glog IWEF entry.
+// Reading past the end of the data does not panic but marks the reader as failed.
 // ffjson: skip
 type iwefreader struct {
 	data     []byte
-	position int // read offset in data
+	position int  // read offset in data
+	failed   bool // a delimiter was missing
 }
 
 // skip advances the position in data
@@ -119,22 +1122,99 @@ func (i *iwefreader) skip() {
 
 // skip advances the position in data
 func (i *iwefreader) skipAllSpace() {
-	for i.data[i.position] == 32 {
+	for i.position < len(i.data) && isSpace(i.data[i.position]) {
 		i.position++
 	}
 	return
 }
 
+// isSpace returns whether the byte separates header tokens; some glog builds use tabs.
+func isSpace(b byte) bool {
+	return b == 32 || b == 9
+}
+
+// stringUpToSpace returns the string part from the data up to not-including a space or tab.
+func (i *iwefreader) stringUpToSpace() string {
+	start := i.position
+	for i.position < len(i.data) && !isSpace(i.data[i.position]) {
+		i.position++
+	}
+	return i.readSince(start)
+}
+
+// readSince returns the string part from the start up to the position; if the position is
+// past the end of the data, it returns what is left and marks the reader as failed.
+func (i *iwefreader) readSince(start int) string {
+	if i.position >= len(i.data) {
+		i.failed = true
+		i.position = len(i.data)
+	}
+	if start >= i.position {
+		return ""
+	}
+	return string(i.data[start:i.position])
+}
+
+// threadName returns the token before file:line, if any, which is the name of the thread
+// on platforms where glog writes it. It is only a name if the rest of the header is a single
+// file:line token and it has no colon or path separator, such that a file path with a space,
+// e.g. /home/my dir/a.go, is not split.
+func (i *iwefreader) threadName() (string, bool) {
+	end := bytes.IndexByte(i.data[i.position:], 93) // ]
+	if end == -1 {
+		return "", false
+	}
+	header := i.data[i.position : i.position+end]
+	space := bytes.IndexAny(header, " \t")
+	if space <= 0 {
+		return "", false
+	}
+	name, rest := header[:space], bytes.TrimLeft(header[space:], " \t")
+	if bytes.IndexAny(name, ":/\\") != -1 || !isFileLine(rest) {
+		return "", false
+	}
+	i.position += space
+	return string(name), true
+}
+
+// isFileLine returns whether the data is a file:line token, without space.
+func isFileLine(data []byte) bool {
+	colon := bytes.LastIndexByte(data, 58)
+	return colon > 0 && colon < len(data)-1 && bytes.IndexAny(data, " \t") == -1
+}
+
 // stringUpToLineEnd returns the string part from the data up to not-including the line end.
 func (i iwefreader) stringUpToLineEnd() string {
+	if i.position >= len(i.data) {
+		return ""
+	}
+	if i.data[len(i.data)-1] != 10 { // truncated line
+		return string(i.data[i.position:])
+	}
 	return string(i.data[i.position : len(i.data)-1]) // without the line delimiter
 }
 
 // stringUpTo returns the string part from the data up to not-including a delimiter.
 func (i *iwefreader) stringUpTo(delim byte) string {
 	start := i.position
-	for i.data[i.position] != delim {
+	for i.position < len(i.data) && i.data[i.position] != delim {
 		i.position++
 	}
+	return i.readSince(start)
+}
+
+// stringUpToLast returns the string part from the data up to not-including the last delimiter before the end byte.
+func (i *iwefreader) stringUpToLast(delim, end byte) string {
+	last := -1
+	for p := i.position; p < len(i.data) && i.data[p] != end; p++ {
+		if i.data[p] == delim {
+			last = p
+		}
+	}
+	if last == -1 {
+		return i.stringUpTo(delim)
+	}
+	start := i.position
+	i.position = last
 	return string(i.data[start:i.position])
 }
@@ -0,0 +1,997 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// decodeEvent unmarshals a logstash json event into a generic map.
+func decodeEvent(t *testing.T, buf []byte) map[string]interface{} {
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &event); err != nil {
+		t.Fatalf("invalid json %q: %v", buf, err)
+	}
+	return event
+}
+
+// decodeEvents unmarshals a stream of logstash json events into generic maps.
+func decodeEvents(t *testing.T, buf []byte) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	for decoder.More() {
+		event := map[string]interface{}{}
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("invalid json %q: %v", buf, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// eventFields returns the @fields object of a decoded event.
+func eventFields(t *testing.T, event map[string]interface{}) map[string]interface{} {
+	fields, ok := event["@fields"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing @fields in %v", event)
+	}
+	return fields
+}
+
+// go test -v -test.run TestWriteLines ...glog
+func TestWriteLines(t *testing.T) {
+	data := []byte("I0102 15:04:05.678901 12345 a.go:10] first\n" +
+		"W0102 15:04:05.678902 12345 b.go:20] second\n" +
+		"E0102 15:04:05.678903 12345 c.go:30] partial")
+	events, err := WriteLines(data, []byte("stack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, expected := range []struct{ level, file, message string }{
+		{"INFO", "a.go", "first"},
+		{"WARNING", "b.go", "second"},
+		{"ERROR", "c.go", "partial"},
+	} {
+		event := decodeEvent(t, events[i])
+		fields := eventFields(t, event)
+		if got := fields["level"]; got != expected.level {
+			t.Errorf("event %d: expected level %q, got %v", i, expected.level, got)
+		}
+		if got := fields["file"]; got != expected.file {
+			t.Errorf("event %d: expected file %q, got %v", i, expected.file, got)
+		}
+		if got := event["message"]; got != expected.message {
+			t.Errorf("event %d: expected message %q, got %v", i, expected.message, got)
+		}
+		if _, ok := fields["stack"]; ok != (i == 2) {
+			t.Errorf("event %d: unexpected stack presence %v", i, ok)
+		}
+	}
+}
+
+// go test -v -test.run TestTimestampNanos ...glog
+func TestTimestampNanos(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 678901000, time.Local) // from the header
+	timeNow = func() time.Time { return now }
+	TimestampNanos = true
+	defer func() { TimestampNanos = false }()
+
+	buf, err := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := eventFields(t, event)["ts_nanos"].(json.Number).Int64()
+	if got != now.UnixNano() {
+		t.Errorf("expected ts_nanos %d, got %d", now.UnixNano(), got)
+	}
+}
+
+// go test -v -test.run TestHeaderTimestamp ...glog
+func TestHeaderTimestamp(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time { return time.Date(2006, 1, 2, 15, 4, 9, 0, time.Local) }
+	defer SetBaseYear(0)
+	for _, each := range []struct {
+		line     string
+		year     int
+		expected time.Time
+	}{
+		{"I0102 15:04:05.678901 12345 a.go:10] buffered\n", 0, time.Date(2006, 1, 2, 15, 4, 5, 678901000, time.Local)},
+		{"I1231 23:59:59.000001 12345 a.go:10] last year\n", 0, time.Date(2005, 12, 31, 23, 59, 59, 1000, time.Local)},
+		{"I0102 15:04:05.678901 12345 a.go:10] old file\n", 2001, time.Date(2001, 1, 2, 15, 4, 5, 678901000, time.Local)},
+		{"I0230 15:04:05.678901 12345 a.go:10] no such day\n", 0, timeNow()},
+		{"I0102 25:04:05.678901 12345 a.go:10] no such hour\n", 0, timeNow()},
+	} {
+		SetBaseYear(each.year)
+		event := decodeEvent(t, mustWrite(t, []byte(each.line)))
+		if got, expected := event["@timestamp"], each.expected.Format(time.RFC3339Nano); got != expected {
+			t.Errorf("%q: expected @timestamp %s, got %v", each.line, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestMalformedHeader ...glog
+func TestMalformedHeader(t *testing.T) {
+	for _, each := range []string{
+		"E0102 15:04:05.678901 12345 a.go:10",
+		"E0102 15:04:05.678901 12345 a.go",
+		"E0102 15:04:05.678901 12345",
+		"E0102 15:04:05 12345 a.go:10 no bracket\n",
+	} {
+		event := decodeEvent(t, mustWrite(t, []byte(each)))
+		fields := eventFields(t, event)
+		if event["message"] != each || fields["level"] != "ERROR" || fields["file"] != nil {
+			t.Errorf("%q: expected the raw message, got %v", each, event)
+		}
+	}
+	// not newline terminated, e.g. written by a panic handler
+	event := decodeEvent(t, mustWrite(t, []byte("E0102 15:04:05.678901 12345 a.go:10] boom")))
+	if event["message"] != "boom" || eventFields(t, event)["file"] != "a.go" {
+		t.Errorf("expected a parsed unterminated line, got %v", event)
+	}
+}
+
+// go test -v -test.run TestPlatform ...glog
+func TestPlatform(t *testing.T) {
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] where\n")
+	if fields := eventFields(t, decodeEvent(t, mustWrite(t, line))); fields["os"] != nil || fields["arch"] != nil {
+		t.Errorf("expected no os and arch by default, got %v", fields)
+	}
+	Platform = true
+	defer func() { Platform = false }()
+	fields := eventFields(t, decodeEvent(t, mustWrite(t, line)))
+	if fields["os"] != runtime.GOOS || fields["arch"] != runtime.GOARCH {
+		t.Errorf("expected os %s and arch %s, got %v", runtime.GOOS, runtime.GOARCH, fields)
+	}
+	FastMode = true
+	defer func() { FastMode = false }()
+	if fields := eventFields(t, decodeEvent(t, mustWrite(t, line))); fields["os"] != nil || fields["arch"] != nil {
+		t.Errorf("expected no os and arch in fast mode, got %v", fields)
+	}
+}
+
+// go test -v -test.run TestShortInput ...glog
+func TestShortInput(t *testing.T) {
+	for _, each := range []string{"", "E", "E0102", "E0102 15:04:05.678901"} {
+		event := decodeEvent(t, mustWrite(t, []byte(each)))
+		if event["message"] != each {
+			t.Errorf("%q: expected the data as message, got %v", each, event["message"])
+		}
+		if level, ok := eventFields(t, event)["level"]; ok {
+			t.Errorf("%q: expected a plain message without level, got %v", each, level)
+		}
+	}
+}
+
+// go test -v -test.run TestVEnabledLevel ...glog
+func TestVEnabledLevel(t *testing.T) {
+	VEnabledLevel = 2
+	defer func() { VEnabledLevel = 0 }()
+	defer func(previous Level) { logging.verbosity.set(previous) }(logging.verbosity.get())
+	logging.verbosity.set(0)
+	logging.vmodule.Set("server*=2,client=1")
+	defer logging.vmodule.Set("")
+	for file, expected := range map[string]interface{}{
+		"server_http.go": true,
+		"client.go":      false,
+		"other.go":       false,
+	} {
+		buf := mustWrite(t, []byte("I0102 15:04:05.678901 12345 "+file+":10] verbose\n"))
+		if got := eventFields(t, decodeEvent(t, buf))["v_enabled"]; got != expected {
+			t.Errorf("%s: expected v_enabled %v, got %v", file, expected, got)
+		}
+	}
+	logging.verbosity.Set("2")
+	buf := mustWrite(t, []byte("I0102 15:04:05.678901 12345 client.go:10] verbose\n"))
+	if got := eventFields(t, decodeEvent(t, buf))["v_enabled"]; got != true {
+		t.Errorf("expected v_enabled by -v, got %v", got)
+	}
+}
+
+// go test -v -test.run TestFileLineWithColonInPath ...glog
+func TestFileLineWithColonInPath(t *testing.T) {
+	for _, each := range []struct{ data, file string }{
+		{"I0102 15:04:05.678901 12345 /home/user/bar.go:42] hello\n", "/home/user/bar.go"},
+		{`I0102 15:04:05.678901 12345 C:\foo\bar.go:42] hello` + "\n", `C:\foo\bar.go`},
+	} {
+		buf, err := WriteWithStack([]byte(each.data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := decodeEvent(t, buf)
+		fields := eventFields(t, event)
+		if got := fields["file"]; got != each.file {
+			t.Errorf("expected file %q, got %v", each.file, got)
+		}
+		if got := fields["line"]; got != float64(42) {
+			t.Errorf("expected line 42, got %v", got)
+		}
+		if got := event["message"]; got != "hello" {
+			t.Errorf("expected message hello, got %v", got)
+		}
+	}
+}
+
+// go test -v -test.run TestFastMode ...glog
+func TestFastMode(t *testing.T) {
+	FastMode = true
+	TimestampNanos = true
+	ExtraFields["fast"] = "no"
+	defer func() {
+		FastMode = false
+		TimestampNanos = false
+		delete(ExtraFields, "fast")
+	}()
+	buf, err := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := eventFields(t, decodeEvent(t, buf))
+	for _, key := range []string{"fast", "ts_nanos"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("expected no %q in fast mode", key)
+		}
+	}
+	for _, key := range []string{"level", "threadid", "file", "line"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("expected %q in fast mode", key)
+		}
+	}
+
+	// no sampling nor file filter
+	defer RestoreConfig(SnapshotConfig())
+	SetSampleRate(1000)
+	SetFileFilter([]string{"other.go"})
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	for i := 0; i < 3; i++ {
+		logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] fast\n"), nil)
+	}
+	logstash.flush()
+	if events := decodeEvents(t, capture.Bytes()); len(events) != 3 {
+		t.Errorf("expected all 3 events in fast mode, got %d", len(events))
+	}
+}
+
+var benchmarkLine = []byte("I0102 15:04:05.678901 12345 glog_json_test.go:10] hello world\n")
+
+func BenchmarkWriteWithStack(b *testing.B) {
+	TimestampNanos = true
+	ExtraFields["bench"] = "mark"
+	defer func() {
+		TimestampNanos = false
+		delete(ExtraFields, "bench")
+	}()
+	for i := 0; i < b.N; i++ {
+		WriteWithStack(benchmarkLine, nil)
+	}
+}
+
+func BenchmarkWriteWithStackFastMode(b *testing.B) {
+	FastMode = true
+	defer func() { FastMode = false }()
+	for i := 0; i < b.N; i++ {
+		WriteWithStack(benchmarkLine, nil)
+	}
+}
+
+func BenchmarkPeekSeverityAndSize(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		PeekSeverityAndSize(benchmarkLine)
+	}
+}
+
+// go test -v -test.run TestSeverityPrefixSearch ...glog
+func TestSeverityPrefixSearch(t *testing.T) {
+	SeverityPrefixSearch = 32
+	defer func() { SeverityPrefixSearch = 0 }()
+	for _, each := range []string{
+		"W0102 15:04:05.678901 12345 a.go:10] hello\n",
+		"2024-01-01 W0102 15:04:05.678901 12345 a.go:10] hello\n",
+	} {
+		buf, err := WriteWithStack([]byte(each), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := decodeEvent(t, buf)
+		fields := eventFields(t, event)
+		if got := fields["level"]; got != "WARNING" {
+			t.Errorf("%q: expected level WARNING, got %v", each, got)
+		}
+		if got := fields["file"]; got != "a.go" {
+			t.Errorf("%q: expected file a.go, got %v", each, got)
+		}
+		if got := event["message"]; got != "hello" {
+			t.Errorf("%q: expected message hello, got %v", each, got)
+		}
+	}
+	if got := peekSeverity([]byte("2024-01-01 E0102 15:04:05.678901 12345 a.go:10] hello\n")); got != ErrorSeverity {
+		t.Errorf("expected ERROR severity, got %v", got)
+	}
+	// not searched when disabled
+	SeverityPrefixSearch = 0
+	buf, _ := WriteWithStack([]byte("2024-01-01 W0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["level"]; ok {
+		t.Error("expected plain message when prefix search is disabled")
+	}
+}
+
+// go test -v -test.run TestSetSeverityName ...glog
+func TestSetSeverityName(t *testing.T) {
+	defer SetSeverityName(ErrorSeverity, "ERROR")
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] failed\n")
+	buf, _ := WriteWithStack(line, nil)
+	if got := eventFields(t, decodeEvent(t, buf))["level"]; got != "ERROR" {
+		t.Errorf("expected level ERROR, got %v", got)
+	}
+	SetSeverityName(ErrorSeverity, "ERR")
+	buf, _ = WriteWithStack(line, nil)
+	if got := eventFields(t, decodeEvent(t, buf))["level"]; got != "ERR" {
+		t.Errorf("expected level ERR, got %v", got)
+	}
+}
+
+// go test -v -test.run TestHostIP ...glog
+func TestHostIP(t *testing.T) {
+	defer func(previous func() ([]net.Addr, error)) { interfaceAddrs = previous }(interfaceAddrs)
+	defer func(previous string) { hostIP = previous }(hostIP)
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("10.1.2.3"), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	hostIP = lookupHostIP()
+	HostIP = true
+	defer func() { HostIP = false }()
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["host_ip"]; got != "10.1.2.3" {
+		t.Errorf("expected host_ip 10.1.2.3, got %v", got)
+	}
+
+	interfaceAddrs = func() ([]net.Addr, error) { return nil, errors.New("no interfaces") }
+	hostIP = lookupHostIP()
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["host_ip"]; ok {
+		t.Error("expected no host_ip when the lookup fails")
+	}
+}
+
+// go test -v -test.run TestPrettyAboveSeverity ...glog
+func TestPrettyAboveSeverity(t *testing.T) {
+	PrettyAboveSeverity = WarningSeverity
+	defer func() { PrettyAboveSeverity = FatalSeverity }()
+	info, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] compact\n"), nil)
+	if bytes.Contains(info, []byte("\n  ")) {
+		t.Errorf("expected compact INFO event, got %s", info)
+	}
+	failure, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] pretty\n"), nil)
+	if !bytes.Contains(failure, []byte("\n  \"@fields\": {\n    ")) {
+		t.Errorf("expected indented ERROR event, got %s", failure)
+	}
+	decodeEvent(t, failure)
+
+	// custom severities are never indented
+	PrettyAboveSeverity = FatalSeverity
+	custom, _ := encodeEvent((*logJSON)(NewEvent(Severity(5), "notice", nil)), Severity(5))
+	if bytes.Contains(custom, []byte("\n  ")) {
+		t.Errorf("expected compact custom event, got %s", custom)
+	}
+}
+
+// go test -v -test.run TestSinceLast ...glog
+func TestSinceLast(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	SinceLast = true
+	atomic.StoreInt64(&lastEventNanos, 0)
+	defer func() { SinceLast = false }()
+
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] hello\n")
+	buf, _ := WriteWithStack(line, nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["since_last_ms"]; ok {
+		t.Error("expected no since_last_ms on the first event")
+	}
+	now = now.Add(1500 * time.Millisecond)
+	buf, _ = WriteWithStack(line, nil)
+	if got := eventFields(t, decodeEvent(t, buf))["since_last_ms"]; got != float64(1500) {
+		t.Errorf("expected since_last_ms 1500, got %v", got)
+	}
+}
+
+// go test -v -test.run TestFilePathPrefixStrip ...glog
+func TestFilePathPrefixStrip(t *testing.T) {
+	SetFilePathPrefixStrip("/home/ci/go/src/")
+	defer SetFilePathPrefixStrip("")
+	for data, expected := range map[string]string{
+		"I0102 15:04:05.678901 12345 /home/ci/go/src/github.com/org/repo/pkg/x.go:10] hello\n": "github.com/org/repo/pkg/x.go",
+		"I0102 15:04:05.678901 12345 /opt/src/pkg/x.go:10] hello\n":                            "/opt/src/pkg/x.go",
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["file"]; got != expected {
+			t.Errorf("expected file %q, got %v", expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestBase64BinaryMessages ...glog
+func TestBase64BinaryMessages(t *testing.T) {
+	Base64BinaryMessages = true
+	defer func() { Base64BinaryMessages = false }()
+	binary := "blob \x00\x01\xff"
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] "+binary+"\n"), nil)
+	event := decodeEvent(t, buf)
+	if got := event["message"]; got != base64.StdEncoding.EncodeToString([]byte(binary)) {
+		t.Errorf("expected base64 message, got %v", got)
+	}
+	if got := eventFields(t, event)["message_encoding"]; got != "base64" {
+		t.Errorf("expected message_encoding base64, got %v", got)
+	}
+
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] text\twith tab\n"), nil)
+	event = decodeEvent(t, buf)
+	if got := event["message"]; got != "text\twith tab" {
+		t.Errorf("expected text message, got %v", got)
+	}
+	if _, ok := eventFields(t, event)["message_encoding"]; ok {
+		t.Error("expected no message_encoding for text")
+	}
+}
+
+// go test -v -test.run TestMarshalLatency ...glog
+func TestMarshalLatency(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	defer func(previous *latencyStats) { marshalLatency = previous }(marshalLatency)
+	marshalLatency = new(latencyStats)
+	MarshalLatency = true
+	defer func() { MarshalLatency = false }()
+
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	for i := 0; i < 3; i++ {
+		WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	}
+	stats := MarshalLatencyStats()
+	if stats.Count != 3 {
+		t.Fatalf("expected 3 measurements, got %d", stats.Count)
+	}
+	if stats.Min != time.Millisecond || stats.Max != time.Millisecond || stats.Avg != time.Millisecond {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// go test -v -test.run TestTruncatedLineLength ...glog
+func TestTruncatedLineLength(t *testing.T) {
+	TruncatedLineLength = 64
+	defer func() { TruncatedLineLength = 0 }()
+	header := "I0102 15:04:05.678901 12345 a.go:10] "
+	truncated := header + strings.Repeat("x", 64-len(header))
+	buf, _ := WriteWithStack([]byte(truncated), nil)
+	event := decodeEvent(t, buf)
+	if got := eventFields(t, event)["source_truncated"]; got != true {
+		t.Errorf("expected source_truncated, got %v", got)
+	}
+	if got := event["message"]; got != strings.Repeat("x", 64-len(header)) {
+		t.Errorf("expected complete message, got %v", got)
+	}
+
+	buf, _ = WriteWithStack([]byte(header+"normal\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["source_truncated"]; ok {
+		t.Error("expected no source_truncated for a normal line")
+	}
+}
+
+// go test -v -test.run TestNewEvent ...glog
+func TestNewEvent(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, 678901000, time.UTC)
+	}
+	buf, err := NewEvent(WarningSeverity, "disk almost full", map[string]interface{}{"free_mb": 12}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := decodeEvent(t, buf)
+	if got := event["@timestamp"]; got != "2006-01-02T15:04:05.678901Z" {
+		t.Errorf("unexpected @timestamp %v", got)
+	}
+	if got := event["@source_host"]; got != host {
+		t.Errorf("unexpected @source_host %v", got)
+	}
+	if got := event["message"]; got != "disk almost full" {
+		t.Errorf("unexpected message %v", got)
+	}
+	fields := eventFields(t, event)
+	if got := fields["level"]; got != "WARNING" {
+		t.Errorf("unexpected level %v", got)
+	}
+	if got := fields["free_mb"]; got != float64(12) {
+		t.Errorf("unexpected free_mb %v", got)
+	}
+	// custom severities are named too
+	SetSeverityName(Severity(5), "NOTICE")
+	defer func() { delete(customLevelNames, Severity(5)) }()
+	if got := NewEvent(Severity(5), "custom", nil).Fields["level"]; got != "NOTICE" {
+		t.Errorf("expected level NOTICE, got %v", got)
+	}
+}
+
+// go test -v -test.run TestSeverityCase ...glog
+func TestSeverityCase(t *testing.T) {
+	defer func() { SeverityCase = UpperCase }()
+	for letterCase, expected := range map[LetterCase]string{
+		UpperCase: "WARNING",
+		TitleCase: "Warning",
+		LowerCase: "warning",
+	} {
+		SeverityCase = letterCase
+		buf, _ := WriteWithStack([]byte("W0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["level"]; got != expected {
+			t.Errorf("expected level %q, got %v", expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestUptime ...glog
+func TestUptime(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	defer func(previous time.Time) { startTime = previous }(startTime)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	startTime = now
+	timeNow = func() time.Time { return now }
+	Uptime = true
+	defer func() { Uptime = false }()
+
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] hello\n")
+	previous := float64(-1)
+	for i := 0; i < 3; i++ {
+		now = now.Add(250 * time.Millisecond)
+		buf, _ := WriteWithStack(line, nil)
+		got, _ := eventFields(t, decodeEvent(t, buf))["uptime_ms"].(float64)
+		if got <= previous {
+			t.Errorf("expected uptime_ms to increase, got %v after %v", got, previous)
+		}
+		previous = got
+	}
+	if previous != 750 {
+		t.Errorf("expected uptime_ms 750, got %v", previous)
+	}
+}
+
+// go test -v -test.run TestLevelText ...glog
+func TestLevelText(t *testing.T) {
+	LevelText = true
+	defer func() { LevelText = false }()
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if fields["level"] != "ERROR" || fields["level_text"] != fields["level"] {
+		t.Errorf("expected level and level_text ERROR, got %v and %v", fields["level"], fields["level_text"])
+	}
+}
+
+// go test -v -test.run TestSeverityNumbering ...glog
+func TestSeverityNumbering(t *testing.T) {
+	LevelValue = true
+	defer func() {
+		LevelValue = false
+		SeverityNumbering = InternalNumbering
+	}()
+	for _, each := range []struct {
+		numbering Numbering
+		expected  []float64
+	}{
+		{InternalNumbering, []float64{0, 1, 2, 3}},
+		{SyslogNumbering, []float64{6, 4, 3, 2}},
+	} {
+		SeverityNumbering = each.numbering
+		for i, level := range "IWEF" {
+			buf, _ := WriteWithStack([]byte(string(level)+"0102 15:04:05.678901 12345 a.go:10] numbered\n"), nil)
+			if got := eventFields(t, decodeEvent(t, buf))["level_value"]; got != each.expected[i] {
+				t.Errorf("numbering %d: expected level_value %v for %c, got %v", each.numbering, each.expected[i], level, got)
+			}
+		}
+	}
+}
+
+// go test -v -test.run TestParseInlineHost ...glog
+func TestParseInlineHost(t *testing.T) {
+	ParseInlineHost = true
+	defer func() { ParseInlineHost = false }()
+	for _, each := range []struct {
+		line, host, message string
+	}{
+		{"I0102 15:04:05.678901 12345 a.go:10] @host=tenant-a served\n", "tenant-a", "served"},
+		{"@host=tenant-b plain line\n", "tenant-b", "plain line"},
+		{"I0102 15:04:05.678901 12345 a.go:10] served for @host=tenant-c\n", host, "served for @host=tenant-c"},
+		{"I0102 15:04:05.678901 12345 a.go:10] @host= empty\n", host, "@host= empty"},
+	} {
+		event := decodeEvent(t, mustWrite(t, []byte(each.line)))
+		if event["@source_host"] != each.host || strings.TrimSpace(event["message"].(string)) != each.message {
+			t.Errorf("%q: expected host %q and message %q, got %v", each.line, each.host, each.message, event)
+		}
+	}
+}
+
+// go test -v -test.run TestMinTimestampResolution ...glog
+func TestMinTimestampResolution(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	defer atomic.StoreInt32(&lowResolutionWarned, 0)
+	warnings := []error{}
+	SetErrorHandler(func(err error) { warnings = append(warnings, err) })
+	MinTimestampResolution = time.Microsecond
+
+	for i := 0; i < 3*lowResolutionRun; i++ {
+		mustWrite(t, []byte("I0102 15:04:05.678901 12345 a.go:10] precise\n"))
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warning for microseconds, got %v", warnings)
+	}
+	for i := 0; i < 3*lowResolutionRun; i++ {
+		mustWrite(t, []byte("I0102 15:04:05.000000 12345 a.go:10] coarse\n"))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "15:04:05.000000") {
+		t.Errorf("expected one warning for seconds, got %v", warnings)
+	}
+}
+
+// go test -v -test.run TestTabSeparatedHeader ...glog
+func TestTabSeparatedHeader(t *testing.T) {
+	for _, each := range []string{
+		"W0102\t15:04:05.678901\t12345\ta.go:10]\ttabbed\n",
+		"W0102 15:04:05.678901\t\t12345\t\ta.go:10] tabbed\n",
+	} {
+		buf, err := WriteWithStack([]byte(each), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := decodeEvent(t, buf)
+		fields := eventFields(t, event)
+		if fields["threadid"] != "12345" || fields["file"] != "a.go" || fields["line"] != float64(10) {
+			t.Errorf("%q: unexpected fields %v", each, fields)
+		}
+		if got := event["message"]; got != "tabbed" {
+			t.Errorf("%q: expected message tabbed, got %q", each, got)
+		}
+	}
+}
+
+// go test -v -test.run TestSeverityScores ...glog
+func TestSeverityScores(t *testing.T) {
+	defer SetSeverityScores(nil)
+	SetSeverityScores(map[Severity]int{WarningSeverity: 5, ErrorSeverity: 20})
+	for data, expected := range map[string]interface{}{
+		"I0102 15:04:05.678901 12345 a.go:10] hello\n":   nil,
+		"W0102 15:04:05.678901 12345 a.go:10] careful\n": float64(5),
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  float64(20),
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["score"]; got != expected {
+			t.Errorf("%q: expected score %v, got %v", data, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestGoroutineCount ...glog
+func TestGoroutineCount(t *testing.T) {
+	GoroutineCount = true
+	defer func() { GoroutineCount = false }()
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), nil)
+	if got, ok := eventFields(t, decodeEvent(t, buf))["goroutines"].(float64); !ok || got < 1 {
+		t.Errorf("expected a positive goroutines count, got %v", got)
+	}
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["goroutines"]; ok {
+		t.Error("expected no goroutines below ERROR")
+	}
+}
+
+// go test -v -test.run TestSeverityInference ...glog
+func TestSeverityInference(t *testing.T) {
+	defer SetSeverityInference(nil)
+	SetSeverityInference(func(data []byte) (Severity, bool) {
+		switch {
+		case bytes.HasPrefix(data, []byte("[warn] ")):
+			return WarningSeverity, true
+		case bytes.HasPrefix(data, []byte("[crit] ")):
+			return ErrorSeverity, true
+		}
+		return InfoSeverity, false
+	})
+	if got := peekSeverity([]byte("[crit] disk failed")); got != ErrorSeverity {
+		t.Errorf("expected ERROR from the inference, got %v", got)
+	}
+	buf, _ := WriteWithStack([]byte("[warn] disk almost full"), nil)
+	event := decodeEvent(t, buf)
+	if got := eventFields(t, event)["level"]; got != "WARNING" {
+		t.Errorf("expected level WARNING, got %v", got)
+	}
+	if got := event["message"]; got != "[warn] disk almost full" {
+		t.Errorf("expected the line as message, got %v", got)
+	}
+	// fall back to the built-in detection
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["level"]; got != "ERROR" {
+		t.Errorf("expected level ERROR, got %v", got)
+	}
+}
+
+// go test -v -test.run TestNormalizeWhitespace ...glog
+func TestNormalizeWhitespace(t *testing.T) {
+	NormalizeWhitespace = true
+	defer func() { NormalizeWhitespace, PreserveNewlines = false, false }()
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] a  lot\tof \t space  \n"), nil)
+	if got := decodeEvent(t, buf)["message"]; got != "a lot of space" {
+		t.Errorf("expected collapsed and trimmed message, got %q", got)
+	}
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] first  line \n  second\tline\n"), nil)
+	if got := decodeEvent(t, buf)["message"]; got != "first line second line" {
+		t.Errorf("expected a single line message, got %q", got)
+	}
+	PreserveNewlines = true
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] first  line \n  second\tline\n"), nil)
+	if got := decodeEvent(t, buf)["message"]; got != "first line\nsecond line" {
+		t.Errorf("expected the newline to be kept, got %q", got)
+	}
+}
+
+// go test -v -test.run TestSeverityOrder ...glog
+func TestSeverityOrder(t *testing.T) {
+	debug, notice := Severity(10), Severity(11)
+	SetSeverityName(debug, "DEBUG")
+	SetSeverityName(notice, "NOTICE")
+	defer SetSeverityInference(nil)
+	SetSeverityInference(func(data []byte) (Severity, bool) {
+		switch {
+		case bytes.HasPrefix(data, []byte("debug:")):
+			return debug, true
+		case bytes.HasPrefix(data, []byte("notice:")):
+			return notice, true
+		}
+		return InfoSeverity, false
+	})
+	defer SetSeverityOrder()
+	SetSeverityOrder(debug, InfoSeverity, notice, WarningSeverity, ErrorSeverity, FatalSeverity)
+	for data, expected := range map[string]struct {
+		level   string
+		ordinal interface{}
+	}{
+		"debug: cache miss":                             {"DEBUG", float64(0)},
+		"I0102 15:04:05.678901 12345 a.go:10] hello\n":  {"INFO", float64(1)},
+		"notice: config reloaded":                       {"NOTICE", float64(2)},
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n": {"ERROR", float64(4)},
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		fields := eventFields(t, decodeEvent(t, buf))
+		if fields["level"] != expected.level || fields["level_ordinal"] != expected.ordinal {
+			t.Errorf("%q: expected %v, got level %v ordinal %v", data, expected, fields["level"], fields["level_ordinal"])
+		}
+	}
+}
+
+// go test -v -test.run TestSetRegion ...glog
+func TestSetRegion(t *testing.T) {
+	defer SetRegion("", "")
+	os.Setenv("CLOUD_ZONE", "europe-west4-a")
+	defer os.Unsetenv("CLOUD_ZONE")
+	SetRegion("europe-west4", "")
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if fields["region"] != "europe-west4" || fields["zone"] != "europe-west4-a" {
+		t.Errorf("expected region from setter and zone from env, got %v %v", fields["region"], fields["zone"])
+	}
+	os.Unsetenv("CLOUD_ZONE")
+	SetRegion("", "")
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] hello\n"), nil)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if _, ok := fields["region"]; ok {
+		t.Errorf("expected no region, got %v", fields["region"])
+	}
+	if _, ok := fields["zone"]; ok {
+		t.Errorf("expected no zone, got %v", fields["zone"])
+	}
+}
+
+// go test -v -test.run TestMonotonicNanos ...glog
+func TestMonotonicNanos(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	MonotonicNanos = true
+	defer func() { MonotonicNanos = false }()
+
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] hello\n")
+	previous := float64(-1)
+	for i := 0; i < 5; i++ {
+		now = now.Add(-time.Hour) // the wall clock is rewound
+		buf, _ := WriteWithStack(line, nil)
+		got, ok := eventFields(t, decodeEvent(t, buf))["mono_ns"].(float64)
+		if !ok || got <= previous {
+			t.Errorf("expected mono_ns to increase, got %v after %v", got, previous)
+		}
+		previous = got
+	}
+}
+
+// go test -v -test.run TestThreadName ...glog
+func TestThreadName(t *testing.T) {
+	buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 worker-1 a.go:10] hello\n"), nil)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if fields["thread_name"] != "worker-1" || fields["threadid"] != "12345" || fields["file"] != "a.go" || fields["line"] != float64(10) {
+		t.Errorf("expected threadid, thread_name, file and line, got %v", fields)
+	}
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 C:\\src\\a.go:10] hello\n"), nil)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if _, ok := fields["thread_name"]; ok || fields["file"] != "C:\\src\\a.go" {
+		t.Errorf("expected no thread_name, got %v", fields)
+	}
+	// a file path with a space
+	buf, _ = WriteWithStack([]byte("I0102 15:04:05.678901 12345 /home/my dir/a.go:10] hello\n"), nil)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if _, ok := fields["thread_name"]; ok || fields["file"] != "/home/my dir/a.go" || fields["line"] != float64(10) {
+		t.Errorf("expected the file with a space and no thread_name, got %v", fields)
+	}
+}
+
+// go test -v -test.run TestSetAlertThreshold ...glog
+func TestSetAlertThreshold(t *testing.T) {
+	SetAlertThreshold(ErrorSeverity)
+	defer SetAlertThreshold(NoAlert)
+	for data, expected := range map[string]interface{}{
+		"W0102 15:04:05.678901 12345 a.go:10] careful\n": nil,
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  true,
+		"F0102 15:04:05.678901 12345 a.go:10] fatal\n":   true,
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["alert"]; got != expected {
+			t.Errorf("%q: expected alert %v, got %v", data, expected, got)
+		}
+	}
+
+	// custom severities only by their order
+	notice, critical := Severity(5), Severity(6)
+	defer SetSeverityInference(nil)
+	inferred := notice
+	SetSeverityInference(func(data []byte) (Severity, bool) { return inferred, true })
+	buf, _ := WriteWithStack([]byte("deploy finished\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["alert"]; got != nil {
+		t.Errorf("expected no alert for an unordered custom severity, got %v", got)
+	}
+	defer SetSeverityOrder()
+	SetSeverityOrder(InfoSeverity, notice, WarningSeverity, ErrorSeverity, critical, FatalSeverity)
+	for sev, expected := range map[Severity]interface{}{notice: nil, critical: true} {
+		inferred = sev
+		buf, _ := WriteWithStack([]byte("deploy finished\n"), nil)
+		if got := eventFields(t, decodeEvent(t, buf))["alert"]; got != expected {
+			t.Errorf("%v: expected alert %v, got %v", sev, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestEventID ...glog
+func TestEventID(t *testing.T) {
+	EventID = true
+	defer func() { EventID = false }()
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] hello\n")
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		buf, _ := WriteWithStack(line, nil)
+		id, _ := eventFields(t, decodeEvent(t, buf))["event_id"].(string)
+		if len(id) != 36 || id[14] != '4' {
+			t.Fatalf("expected a version 4 UUID, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate event_id %q", id)
+		}
+		seen[id] = true
+	}
+
+	defer SetEventIDGenerator(nil)
+	SetEventIDGenerator(func() string { return "fixed-id" })
+	buf, _ := WriteWithStack(line, nil)
+	if got := eventFields(t, decodeEvent(t, buf))["event_id"]; got != "fixed-id" {
+		t.Errorf("expected the generated id, got %v", got)
+	}
+}
+
+// go test -v -test.run TestIncludeOnSeverity ...glog
+func TestIncludeOnSeverity(t *testing.T) {
+	defer func() { fieldSeverities = map[string]Severity{} }()
+	IncludeOnSeverity("uptime_ms", ErrorSeverity)
+	IncludeOnSeverity("goroutines", FatalSeverity)
+	Uptime, GoroutineCount = true, true
+	defer func() { Uptime, GoroutineCount = false, false }()
+	for data, expected := range map[string][]bool{
+		"W0102 15:04:05.678901 12345 a.go:10] careful\n": {false, false},
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  {true, false},
+		"F0102 15:04:05.678901 12345 a.go:10] fatal\n":   {true, true},
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		fields := eventFields(t, decodeEvent(t, buf))
+		for i, key := range []string{"uptime_ms", "goroutines"} {
+			if _, ok := fields[key]; ok != expected[i] {
+				t.Errorf("%q: expected %s included %v, got %v", data, key, expected[i], ok)
+			}
+		}
+	}
+}
+
+// go test -v -test.run TestUnknownLineNumber ...glog
+func TestUnknownLineNumber(t *testing.T) {
+	defer func() { UnknownLineNumber = ZeroLineNumber }()
+	for _, each := range []struct {
+		policy  LineNumberPolicy
+		line    string
+		present bool
+		value   interface{}
+	}{
+		{ZeroLineNumber, "10", true, float64(10)},
+		{ZeroLineNumber, "0", true, float64(0)},
+		{ZeroLineNumber, "??", true, float64(0)},
+		{NullLineNumber, "0", true, float64(0)},
+		{NullLineNumber, "??", true, nil},
+		{OmitLineNumber, "10", true, float64(10)},
+		{OmitLineNumber, "??", false, nil},
+	} {
+		UnknownLineNumber = each.policy
+		buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:"+each.line+"] hello\n"), nil)
+		got, ok := eventFields(t, decodeEvent(t, buf))["line"]
+		if ok != each.present || got != each.value {
+			t.Errorf("policy %d, line %q: expected %v (present %v), got %v (present %v)", each.policy, each.line, each.value, each.present, got, ok)
+		}
+	}
+}
+
+// go test -v -test.run TestPeekSeverityAndSize ...glog
+func TestPeekSeverityAndSize(t *testing.T) {
+	for data, expected := range map[string]Severity{
+		"I0102 15:04:05.678901 12345 a.go:10] hello\n":   InfoSeverity,
+		"W0102 15:04:05.678901 12345 a.go:10] careful\n": WarningSeverity,
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  ErrorSeverity,
+		"plain message": PlainMessageSeverity,
+		"":              PlainMessageSeverity,
+	} {
+		sev, size := PeekSeverityAndSize([]byte(data))
+		if sev != expected || size != len(data) {
+			t.Errorf("%q: expected %v and %d, got %v and %d", data, expected, len(data), sev, size)
+		}
+	}
+}
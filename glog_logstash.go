@@ -20,19 +20,247 @@ import (
 	"flag"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ExtraFields contains a set of @fields elements that can be used by the application
 // to pass appliction and/or environment specific information.
+// Changing it while events are written is not safe; use SetExtraField and DeleteExtraField instead.
 var ExtraFields = map[string]string{}
 
+// extraFieldsMu guards ExtraFields, extraValues and staticFields.
+var extraFieldsMu sync.RWMutex
+
+// extraValues holds the @fields elements set by SetExtraField.
+var extraValues = map[string]interface{}{}
+
+// SetExtraField adds an element to the @fields of each event, or replaces it.
+// It is safe to call while events are written.
+func SetExtraField(key string, value interface{}) {
+	extraFieldsMu.Lock()
+	delete(ExtraFields, key)
+	extraValues[key] = value
+	extraFieldsMu.Unlock()
+}
+
+// DeleteExtraField removes an element set by SetExtraField or in ExtraFields.
+// It is safe to call while events are written.
+func DeleteExtraField(key string) {
+	extraFieldsMu.Lock()
+	delete(ExtraFields, key)
+	delete(extraValues, key)
+	extraFieldsMu.Unlock()
+}
+
+// SnapshotExtraFields returns a copy of the elements set by SetExtraField, in ExtraFields
+// and loaded by LoadStaticFieldsFromFile.
+func SnapshotExtraFields() map[string]interface{} {
+	snapshot := map[string]interface{}{}
+	addExtraFields(snapshot)
+	return snapshot
+}
+
+// addExtraFields copies the extra elements into the fields.
+func addExtraFields(fields map[string]interface{}) {
+	extraFieldsMu.RLock()
+	for k, v := range ExtraFields {
+		fields[k] = v
+	}
+	for k, v := range extraValues {
+		fields[k] = v
+	}
+	for k, v := range staticFields {
+		fields[k] = v
+	}
+	extraFieldsMu.RUnlock()
+}
+
 // logstash is a logstashPublisher that decodes each glog data,
 // encodes it into JSON and writes it to an io.Writer.
 var logstash logstashPublisher
 
 // Set the io.Writer to write JSON. This is required if -logstash=true
+// Events buffered for the previous writer are not lost, see WriterSwapPolicy.
 func SetLogstashWriter(writer io.Writer) {
-	logstash.writer = newBufferedWriter(writer)
+	logging.mu.Lock()
+	logstash.writer = swapWriter(logstash.writer, writer, WriterSwapPolicy == HandOffOnSwap)
+	logging.mu.Unlock()
+}
+
+// SetAlsoJSONTo sets an io.Writer (e.g. os.Stderr) that receives a JSON copy of each event,
+// regardless of the -logstash flag and without changing the text output to the log files.
+// Pass nil to stop writing the copy.
+func SetAlsoJSONTo(writer io.Writer) {
+	logging.mu.Lock()
+	if writer == nil {
+		logstash.alsoJSON = nil
+	} else {
+		logstash.alsoJSON = newBufferedWriter(writer)
+	}
+	logging.mu.Unlock()
+}
+
+// AlsoJSONToStderr toggles writing a JSON copy of each event to Stderr, as read by most container log collectors.
+func AlsoJSONToStderr(enabled bool) {
+	if enabled {
+		SetAlsoJSONTo(os.Stderr)
+	} else {
+		SetAlsoJSONTo(nil)
+	}
+}
+
+// deadLetter receives the messages that could not be written by the Logstash writer.
+var deadLetter io.Writer
+
+// SetDeadLetter sets the io.Writer (e.g. a local file) that receives the JSON messages
+// the Logstash writer failed to write. Pass nil to report such messages on Stderr only.
+func SetDeadLetter(writer io.Writer) {
+	logging.mu.Lock()
+	deadLetter = writer
+	logging.mu.Unlock()
+}
+
+// errorHandler receives the internal errors and warnings of the JSON encoding.
+var errorHandler = defaultErrorHandler
+
+// defaultErrorHandler writes the error to Stderr.
+func defaultErrorHandler(err error) {
+	os.Stderr.WriteString("[glog error] " + err.Error() + "\n")
+}
+
+// SetErrorHandler sets the function that receives internal errors and warnings,
+// e.g. to count them in a metric. Pass nil to write them to Stderr, the default.
+func SetErrorHandler(handler func(error)) {
+	logging.mu.Lock()
+	if handler == nil {
+		errorHandler = defaultErrorHandler
+	} else {
+		errorHandler = handler
+	}
+	logging.mu.Unlock()
+}
+
+// fatalSink receives the FATAL events directly, see SetFatalSink.
+var fatalSink io.Writer
+
+// SetFatalSink sets an io.Writer (e.g. a local file) that receives each FATAL event synchronously,
+// before the process exits, independent of the buffered Logstash writer and sinks.
+// The writer is flushed or synced after each event if it supports that. Pass nil to remove it.
+func SetFatalSink(writer io.Writer) {
+	logging.mu.Lock()
+	fatalSink = writer
+	logging.mu.Unlock()
+}
+
+// writeFatalWithStack decodes the FATAL data and writes the event only to the fatal sink,
+// for when publishing is not enabled.
+func writeFatalWithStack(data []byte, stack []byte) {
+	defer enterPublishing()()
+	writeFatalEvent(data, stack)
+}
+
+// writeFatalEvent decodes the FATAL data, writes the event to the fatal sink and returns it.
+func writeFatalEvent(data []byte, stack []byte) (*logJSON, []byte) {
+	log, sev := parseEvent(data, stack)
+	buf, _ := encodeEvent(log, sev)
+	writeFatal(buf)
+	return log, buf
+}
+
+// writeFatal writes the encoded FATAL event to the fatal sink and flushes it.
+func writeFatal(buf []byte) {
+	fatalSink.Write(append(buf[:len(buf):len(buf)], '\n'))
+	switch w := fatalSink.(type) {
+	case interface {
+		Flush() error
+	}:
+		w.Flush()
+	case interface {
+		Sync() error
+	}:
+		w.Sync()
+	}
+}
+
+// SetPostMarshal sets a transform that is applied to each JSON event before it is
+// written, e.g. to add a length header for a framed protocol. The record separator
+// is written after the transformed event. Pass nil to remove the transform.
+func SetPostMarshal(transform func([]byte) []byte) {
+	logging.mu.Lock()
+	logstash.postMarshal = transform
+	logging.mu.Unlock()
+}
+
+// sampleRate is the 1-in-N sampling of events. Handled atomically.
+var sampleRate int64
+
+// sampleCount counts the events offered for sampling. Handled atomically.
+var sampleCount int64
+
+// SetSampleRate makes the Logstash writer write only 1 in rate events. Written events
+// get a sample_rate field so counts can be scaled. A rate of 1 or less writes all events.
+func SetSampleRate(rate int) {
+	atomic.StoreInt64(&sampleCount, 0)
+	atomic.StoreInt64(&sampleRate, int64(rate))
+}
+
+// fileFilter holds the glob patterns of the files whose events are written, see SetFileFilter.
+var fileFilter []string
+
+// SetFileFilter makes the Logstash writer and sinks write only the events whose file matches one
+// of the patterns, e.g. "server*.go", analogous to the -vmodule flag; other events, including those
+// without a file, are dropped. The patterns use the syntax of filepath.Match. Pass nil to write all events.
+func SetFileFilter(patterns []string) {
+	logging.mu.Lock()
+	fileFilter = patterns
+	logging.mu.Unlock()
+}
+
+// filteredOut returns whether the file of the event matches none of the patterns of the file filter.
+func filteredOut(log *logJSON) bool {
+	if FastMode || len(fileFilter) == 0 {
+		return false
+	}
+	file, _ := log.Fields[fileKey].(string)
+	for _, each := range fileFilter {
+		if matched, _ := filepath.Match(each, file); matched && file != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Severity identifies the level of a logstash event. The values match the glog severities.
+type Severity int32
+
+const (
+	InfoSeverity    = Severity(infoLog)
+	WarningSeverity = Severity(warningLog)
+	ErrorSeverity   = Severity(errorLog)
+	FatalSeverity   = Severity(fatalLog)
+)
+
+// String returns the glog name of the severity, e.g. "WARNING".
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityName) {
+		return strconv.Itoa(int(s))
+	}
+	return severityName[s]
+}
+
+// PlainMessageSeverity is the severity assumed for plain (non IWEF) messages
+// when they are compared to the logstash threshold.
+var PlainMessageSeverity = InfoSeverity
+
+// SetLogstashThreshold sets the minimum severity of events written to the Logstash writer.
+func SetLogstashThreshold(threshold Severity) {
+	logging.mu.Lock()
+	logstash.threshold = threshold
+	logging.mu.Unlock()
 }
 
 func init() {
@@ -43,27 +271,96 @@ func init() {
 
 // logstashPublisher holds global state for publishing messages in JSON.
 type logstashPublisher struct {
-	toLogstash bool            // The -logstash flag.
-	writer     *bufferedWriter // Buffered target writer for JSON messages.
+	toLogstash  bool                // The -logstash flag.
+	writer      *bufferedWriter     // Buffered target writer for JSON messages.
+	threshold   Severity            // Events below this severity are not written.
+	postMarshal func([]byte) []byte // Optional transform of each encoded event.
+	sinks       []*sinkWriter       // Additional targets, see AddSink.
+	alsoJSON    *bufferedWriter     // Optional copy of the JSON events, see SetAlsoJSONTo.
+}
+
+// enabled returns whether events must be published at all.
+func (p logstashPublisher) enabled() bool {
+	return p.toLogstash || p.alsoJSON != nil
 }
 
-// WriteWithStack decodes the data and writes a logstash json event
+// WriteWithStack decodes the data and writes a logstash json event.
+// A FATAL event is written to the fatal sink regardless of the threshold, sampling and
+// file filter; it is never sampled.
 func (p logstashPublisher) WriteWithStack(data []byte, stack []byte) {
-	buf, _ := WriteWithStack(data, stack)
+	defer enterPublishing()()
+	peeked := peekSeverity(data)
+	if peeked == FatalSeverity && fatalSink != nil {
+		log, buf := writeFatalEvent(data, stack)
+		if peeked >= p.threshold && !filteredOut(log) {
+			p.write(data, log, buf)
+		}
+		return
+	}
+	if peeked < p.threshold {
+		return
+	}
+	rate := int64(0) // no sampling in FastMode
+	if !FastMode {
+		rate = atomic.LoadInt64(&sampleRate)
+	}
+	if rate > 1 && atomic.AddInt64(&sampleCount, 1)%rate != 1 {
+		return
+	}
+	log, sev := parseEvent(data, stack)
+	if filteredOut(log) {
+		return
+	}
+	if rate > 1 {
+		log.Fields[sampleRateKey] = rate
+	}
+	p.publish(data, log, sev)
+}
+
+// publish encodes the decoded event and writes it to the sinks and the writer.
+func (p logstashPublisher) publish(data []byte, log *logJSON, sev Severity) {
+	buf, _ := encodeEvent(log, sev)
+	p.write(data, log, buf)
+}
+
+// write writes the encoded event to the sinks and the writer.
+func (p logstashPublisher) write(data []byte, log *logJSON, buf []byte) {
+	// the event is encoded once for all sinks
+	for _, each := range p.sinks {
+		each.write(data, log, buf)
+	}
+	if p.alsoJSON != nil {
+		p.alsoJSON.Write(buf)
+		p.alsoJSON.Write([]byte("\n"))
+		if !p.toLogstash { // only publishing the copy
+			return
+		}
+	}
+	if p.postMarshal != nil {
+		buf = p.postMarshal(buf)
+	}
 	p.writer.Write(buf)
 	p.writer.Write([]byte("\n"))
 }
 
 // flush waits until all pending messages are written by the asyncWriter.
 func (p logstashPublisher) flush() {
+	defer enterPublishing()()
 	if p.writer != nil { // be robust
 		p.writer.flush()
 	}
+	for _, each := range p.sinks {
+		each.writer.flush()
+	}
+	if p.alsoJSON != nil {
+		p.alsoJSON.flush()
+	}
 }
 
 // bufferedWriter collects []byte until a flush.
 type bufferedWriter struct {
 	buffer [][]byte
+	events map[int]*Event // by index in buffer, written instead to an EventWriter
 	writer io.Writer
 }
 
@@ -81,14 +378,78 @@ func (b *bufferedWriter) Write(data []byte) (n int, err error) {
 	return len(data), nil
 }
 
+// writeEvent collects the event and the data from which it was decoded.
+func (b *bufferedWriter) writeEvent(data []byte, event *Event) {
+	if b.events == nil {
+		b.events = map[int]*Event{}
+	}
+	b.events[len(b.buffer)] = event
+	b.buffer = append(b.buffer, data)
+}
+
 // flush drains the buffer. it is called from the daemon goroutine.
 func (b *bufferedWriter) flush() {
-	for _, each := range b.buffer {
-		_, err := b.writer.Write(each)
+	waited := time.Duration(0) // the retry budget is shared by all messages
+	for i, each := range b.buffer {
+		err := b.writeWithRetry(each, b.events[i], &waited)
 		if err != nil {
+			if deadLetter != nil {
+				if _, err = deadLetter.Write(each); err == nil {
+					continue
+				}
+			}
 			os.Stderr.WriteString("[glog error] unable to flush buffered logstash message:\n")
 			os.Stderr.WriteString(string(each))
 		}
 	}
 	b.buffer = [][]byte{}
+	b.events = nil
+}
+
+// writeWithRetry writes the data, or the event decoded from it to an EventWriter, retrying
+// with backoff on failure as configured by SetWriteRetry.
+// Waiting is added to waited and stops when that would exceed the maximum wait.
+func (b *bufferedWriter) writeWithRetry(data []byte, event *Event, waited *time.Duration) error {
+	err := b.write(data, event)
+	backoff := writeRetry.backoff
+	for attempt := 0; err != nil && attempt < writeRetry.retries; attempt++ {
+		if *waited+backoff > writeRetry.maxWait {
+			break
+		}
+		sleep(backoff)
+		*waited += backoff
+		backoff *= 2
+		err = b.write(data, event)
+	}
+	return err
+}
+
+// write writes the event if the writer is an EventWriter, the data otherwise.
+func (b *bufferedWriter) write(data []byte, event *Event) error {
+	if events, ok := b.writer.(EventWriter); ok && event != nil {
+		return events.WriteEvent(event)
+	}
+	_, err := b.writer.Write(data)
+	return err
+}
+
+// writeRetry holds the retry configuration of all writers; it is modified under logging.mu.
+var writeRetry struct {
+	retries int
+	backoff time.Duration
+	maxWait time.Duration
+}
+
+var sleep = time.Sleep // Stubbed out for testing.
+
+// SetWriteRetry makes the Logstash writer and sinks retry a failed write up to retries times,
+// waiting backoff before the first retry and doubling it for each next one. The total waiting
+// for a flush of the buffered messages is bounded by maxWait so logging is never blocked indefinitely.
+// A message that still fails goes to the dead letter writer.
+func SetWriteRetry(retries int, backoff, maxWait time.Duration) {
+	logging.mu.Lock()
+	writeRetry.retries = retries
+	writeRetry.backoff = backoff
+	writeRetry.maxWait = maxWait
+	logging.mu.Unlock()
 }
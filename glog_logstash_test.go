@@ -19,7 +19,9 @@ package glog
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -94,3 +96,298 @@ func ExampleSetLogstashWriter() {
 		os.Stderr.Write([]byte("unable to create logstash.log:" + err.Error()))
 	}
 }
+
+// go test -v -test.run TestPlainMessageSeverity ...glog
+func TestPlainMessageSeverity(t *testing.T) {
+	defer func(previous Severity) { PlainMessageSeverity = previous }(PlainMessageSeverity)
+	defer SetLogstashThreshold(InfoSeverity)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	SetLogstashThreshold(WarningSeverity)
+
+	PlainMessageSeverity = InfoSeverity
+	logstash.WriteWithStack([]byte("plain as info\n"), nil)
+	logstash.flush()
+	if capture.Len() != 0 {
+		t.Fatalf("expected plain message below threshold to be dropped, got %q", capture.String())
+	}
+
+	PlainMessageSeverity = WarningSeverity
+	logstash.WriteWithStack([]byte("plain as warning\n"), nil)
+	logstash.flush()
+	if !strings.Contains(capture.String(), "plain as warning") {
+		t.Fatalf("expected plain message at threshold to be written, got %q", capture.String())
+	}
+}
+
+// go test -v -test.run TestPostMarshal ...glog
+func TestPostMarshal(t *testing.T) {
+	defer SetPostMarshal(nil)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	SetPostMarshal(func(event []byte) []byte {
+		return append([]byte(fmt.Sprintf("%08d", len(event))), event...)
+	})
+	logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] framed\n"), nil)
+	logstash.flush()
+
+	framed := capture.Bytes()
+	size, err := strconv.Atoi(string(framed[:8]))
+	if err != nil {
+		t.Fatalf("missing length header in %q", framed)
+	}
+	event := framed[8 : 8+size]
+	if !bytes.HasPrefix(event, []byte("{")) || !bytes.HasSuffix(bytes.TrimSpace(event), []byte("}")) {
+		t.Errorf("length header does not frame the event: %q", framed)
+	}
+	if rest := string(framed[8+size:]); rest != "\n" {
+		t.Errorf("expected record separator after the framed event, got %q", rest)
+	}
+}
+
+// go test -v -test.run TestDeadLetter ...glog
+func TestDeadLetter(t *testing.T) {
+	defer SetDeadLetter(nil)
+	dead := new(bytes.Buffer)
+	SetDeadLetter(dead)
+	SetLogstashWriter(failingWriter{})
+	logstash.WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] lost?\n"), nil)
+	logstash.flush()
+	if !strings.Contains(dead.String(), `"message":"lost?"`) {
+		t.Errorf("expected event in dead letter writer, got %q", dead.String())
+	}
+}
+
+// go test -v -test.run TestSampleRate ...glog
+func TestSampleRate(t *testing.T) {
+	defer SetSampleRate(0)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	SetSampleRate(10)
+	for i := 0; i < 20; i++ {
+		logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] sampled\n"), nil)
+	}
+	logstash.flush()
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 sampled events, got %d", len(events))
+	}
+	for _, each := range events {
+		if got := eventFields(t, each)["sample_rate"]; got != float64(10) {
+			t.Errorf("expected sample_rate 10, got %v", got)
+		}
+	}
+
+	capture.Reset()
+	SetSampleRate(0)
+	logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] all\n"), nil)
+	logstash.flush()
+	if _, ok := eventFields(t, decodeEvent(t, capture.Bytes()))["sample_rate"]; ok {
+		t.Error("expected no sample_rate when sampling is off")
+	}
+}
+
+// flakyWriter fails a number of writes before it succeeds.
+type flakyWriter struct {
+	failures int
+	bytes.Buffer
+}
+
+func (f *flakyWriter) Write(p []byte) (n int, err error) {
+	if f.failures > 0 {
+		f.failures--
+		return 0, errors.New("simulated transient fail")
+	}
+	return f.Buffer.Write(p)
+}
+
+// go test -v -test.run TestWriteRetry ...glog
+func TestWriteRetry(t *testing.T) {
+	defer func(previous func(time.Duration)) { sleep = previous }(sleep)
+	waits := []time.Duration{}
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer SetWriteRetry(0, 0, 0)
+	SetWriteRetry(3, 10*time.Millisecond, time.Second)
+
+	flaky := &flakyWriter{failures: 2}
+	SetLogstashWriter(flaky)
+	logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] eventually\n"), nil)
+	logstash.flush()
+	if !strings.Contains(flaky.String(), `"message":"eventually"`) {
+		t.Errorf("expected event after retries, got %q", flaky.String())
+	}
+	if len(waits) != 2 || waits[0] != 10*time.Millisecond || waits[1] != 20*time.Millisecond {
+		t.Errorf("unexpected backoff %v", waits)
+	}
+
+	// bounded by the maximum wait
+	waits = waits[:0]
+	SetWriteRetry(3, 10*time.Millisecond, 15*time.Millisecond)
+	dead := new(bytes.Buffer)
+	SetDeadLetter(dead)
+	defer SetDeadLetter(nil)
+	SetLogstashWriter(&flakyWriter{failures: 2})
+	logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] given up\n"), nil)
+	logstash.flush()
+	if len(waits) != 1 {
+		t.Errorf("expected a single wait, got %v", waits)
+	}
+	if !strings.Contains(dead.String(), `"message":"given up"`) {
+		t.Errorf("expected event in dead letter writer, got %q", dead.String())
+	}
+	// the budget is shared by the messages of a flush
+	waits = waits[:0]
+	dead.Reset()
+	SetLogstashWriter(&flakyWriter{failures: 10})
+	for _, each := range []string{"one", "two", "three"} {
+		logstash.WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] "+each+"\n"), nil)
+	}
+	logstash.flush()
+	if len(waits) != 1 {
+		t.Errorf("expected a single wait for the flush, got %v", waits)
+	}
+	if got := strings.Count(dead.String(), `"message"`); got != 3 {
+		t.Errorf("expected 3 events in dead letter writer, got %d", got)
+	}
+}
+
+// go test -v -test.run TestSetAlsoJSONTo ...glog
+func TestSetAlsoJSONTo(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	capture := new(bytes.Buffer)
+	SetAlsoJSONTo(capture)
+	defer SetAlsoJSONTo(nil)
+	logstash.toLogstash = false
+	Info("both")
+	Flush()
+	if !contains(infoLog, "both", t) {
+		t.Errorf("expected text output in the log file, got %q", contents(infoLog))
+	}
+	if got := decodeEvent(t, capture.Bytes())["message"]; got != "both" {
+		t.Errorf("expected JSON copy, got %q", capture.String())
+	}
+}
+
+// syncedBuffer is a bytes.Buffer that counts the calls of Sync.
+type syncedBuffer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (s *syncedBuffer) Sync() error {
+	s.syncs++
+	return nil
+}
+
+// go test -v -test.run TestSetFatalSink ...glog
+func TestSetFatalSink(t *testing.T) {
+	defer func(previous *bufferedWriter) { logstash.writer = previous }(logstash.writer)
+	buffered := new(bytes.Buffer)
+	SetLogstashWriter(buffered)
+	sink := new(syncedBuffer)
+	SetFatalSink(sink)
+	defer SetFatalSink(nil)
+
+	logstash.WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] error\n"), nil)
+	if sink.Len() > 0 {
+		t.Errorf("expected no ERROR event in the fatal sink, got %q", sink.String())
+	}
+	logstash.WriteWithStack([]byte("F0102 15:04:05.678901 12345 a.go:11] fatal\n"), nil)
+	if buffered.Len() > 0 {
+		t.Fatalf("expected the normal writer to be buffered, got %q", buffered.String())
+	}
+	event := decodeEvent(t, sink.Bytes())
+	if event["message"] != "fatal" || eventFields(t, event)["level"] != "FATAL" || sink.syncs != 1 {
+		t.Errorf("expected the synced FATAL event, got %q after %d syncs", sink.String(), sink.syncs)
+	}
+	logstash.flush()
+	if events := decodeEvents(t, buffered.Bytes()); len(events) != 2 {
+		t.Errorf("expected both events in the normal writer, got %d", len(events))
+	}
+
+	// regardless of sampling, the file filter and publishing
+	defer RestoreConfig(SnapshotConfig())
+	SetSampleRate(1000)
+	SetFileFilter([]string{"other.go"})
+	sink.Reset()
+	logstash.WriteWithStack([]byte("F0102 15:04:05.678901 12345 a.go:12] sampled\n"), nil)
+	logstash.WriteWithStack([]byte("F0102 15:04:05.678901 12345 a.go:13] filtered\n"), nil)
+	writeFatalWithStack([]byte("F0102 15:04:05.678901 12345 a.go:14] not published\n"), nil)
+	if events := decodeEvents(t, sink.Bytes()); len(events) != 3 {
+		t.Errorf("expected 3 FATAL events in the fatal sink, got %d", len(events))
+	}
+	// custom severities numbered above FATAL are not FATAL
+	SetSampleRate(0)
+	SetFileFilter(nil)
+	SetSeverityName(Severity(5), "NOTICE")
+	SetSeverityInference(func(data []byte) (Severity, bool) { return Severity(5), true })
+	sink.Reset()
+	logstash.WriteWithStack([]byte("NOTICE deploy finished\n"), nil)
+	if sink.Len() > 0 {
+		t.Errorf("expected no NOTICE event in the fatal sink, got %q", sink.String())
+	}
+}
+
+// go test -v -test.run TestSetFileFilter ...glog
+func TestSetFileFilter(t *testing.T) {
+	defer func(previous *bufferedWriter) { logstash.writer = previous }(logstash.writer)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	SetFileFilter([]string{"server*.go", "db.go"})
+	defer SetFileFilter(nil)
+
+	for _, each := range []string{
+		"I0102 15:04:05.678901 12345 server_http.go:10] kept\n",
+		"I0102 15:04:05.678901 12345 client.go:10] dropped\n",
+		"I0102 15:04:05.678901 12345 db.go:10] kept\n",
+		"plain line dropped\n",
+	} {
+		logstash.WriteWithStack([]byte(each), nil)
+	}
+	logstash.flush()
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %q", len(events), capture.String())
+	}
+	for _, each := range events {
+		if each["message"] != "kept" {
+			t.Errorf("unexpected event %v", each)
+		}
+	}
+}
+
+// go test -v -test.run TestSetExtraField ...glog
+func TestSetExtraField(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	ExtraFields = map[string]string{"role": "web", "zone": "eu"}
+	SetExtraField("build", 42)
+	SetExtraField("role", "api")
+	DeleteExtraField("zone")
+
+	fields := eventFields(t, decodeEvent(t, mustWrite(t, []byte("I0102 15:04:05.678901 12345 a.go:10] extra\n"))))
+	if fields["build"] != float64(42) || fields["role"] != "api" || fields["zone"] != nil {
+		t.Errorf("expected build and role but no zone, got %v", fields)
+	}
+	snapshot := SnapshotExtraFields()
+	if len(snapshot) != 2 || snapshot["build"] != 42 || snapshot["role"] != "api" {
+		t.Errorf("unexpected snapshot %v", snapshot)
+	}
+}
+
+// go test -v -race -test.run TestSetExtraFieldConcurrently ...glog
+func TestSetExtraFieldConcurrently(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			SetExtraField("request"+strconv.Itoa(i%10), i)
+			DeleteExtraField("request" + strconv.Itoa((i+5)%10))
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		mustWrite(t, []byte("I0102 15:04:05.678901 12345 a.go:10] concurrent\n"))
+	}
+	<-done
+}
@@ -0,0 +1,246 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+)
+
+// fieldOrder lists the @fields keys that are written first.
+var fieldOrder []string
+
+// SetFieldOrder sets the order in which @fields keys are written, e.g. for golden-file tests.
+// Keys that are not listed follow in sorted order. Pass nil to restore the default.
+func SetFieldOrder(keys []string) {
+	logging.mu.Lock()
+	fieldOrder = keys
+	logging.mu.Unlock()
+}
+
+// fieldsKey is the key of the object that holds the fields of an event.
+var fieldsKey = "@fields"
+
+// SetFieldsKey changes the key of the @fields object, e.g. to "metadata" or "context".
+func SetFieldsKey(key string) {
+	logging.mu.Lock()
+	fieldsKey = key
+	logging.mu.Unlock()
+}
+
+// rootWrapper is the key of the object that holds the event; empty means no wrapper.
+var rootWrapper = ""
+
+// SetRootWrapper nests each event under the key, e.g. {"log":{...}} for "log",
+// as required by some ingestion APIs. Pass "" to remove the wrapper.
+func SetRootWrapper(key string) {
+	logging.mu.Lock()
+	rootWrapper = key
+	logging.mu.Unlock()
+}
+
+// OmitSourceHost leaves out the @source_host field, e.g. when the collector adds the host itself.
+var OmitSourceHost = false
+
+// ESCompatTimestamps writes the @timestamp with exactly three fractional digits, truncated to
+// milliseconds, e.g. "2006-01-02T15:04:05.678Z", as handled by the default Elasticsearch date mapping.
+var ESCompatTimestamps = false
+
+// esTimestampLayout is the RFC3339 layout with milliseconds.
+const esTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// labels holds the string values of the labels object of each event, see SetLabels.
+var labels map[string]string
+
+// SetLabels adds a labels object with the string values to each event, next to @fields,
+// for systems like ECS that index labels separately from free-form fields. Pass nil to remove it.
+func SetLabels(values map[string]string) {
+	copied := map[string]string{}
+	for k, v := range values {
+		copied[k] = v
+	}
+	if len(copied) == 0 {
+		copied = nil
+	}
+	logging.mu.Lock()
+	labels = copied
+	logging.mu.Unlock()
+}
+
+// FallbackToStdJSON encodes an event using encoding/json if the generated marshaller fails,
+// instead of dropping it. See StdJSONFallbacks.
+var FallbackToStdJSON = true
+
+var ffjsonMarshal = (*logJSON).MarshalJSON // Stubbed out for testing.
+
+// stdJSONFallbacks counts the events encoded by the fallback. Handled atomically.
+var stdJSONFallbacks int64
+
+// StdJSONFallbacks returns the number of events encoded using encoding/json because
+// the generated marshaller failed.
+func StdJSONFallbacks() int64 {
+	return atomic.LoadInt64(&stdJSONFallbacks)
+}
+
+// customMarshal returns whether the configuration requires marshalEvent
+// instead of the generated MarshalJSON.
+func customMarshal() bool {
+	return len(fieldOrder) > 0 || fieldsKey != "@fields" || len(labels) > 0 || OmitSourceHost || ESCompatTimestamps
+}
+
+// marshal returns the logstash json event, using marshalEvent if the configuration requires it.
+func marshal(log *logJSON) ([]byte, error) {
+	var buf []byte
+	var err error
+	if customMarshal() {
+		buf, err = marshalEvent(log)
+	} else {
+		buf, err = ffjsonMarshal(log)
+		if err != nil && FallbackToStdJSON {
+			atomic.AddInt64(&stdJSONFallbacks, 1)
+			buf, err = marshalEvent(log)
+		}
+	}
+	if err != nil || rootWrapper == "" {
+		return buf, err
+	}
+	wrapped := new(bytes.Buffer)
+	wrapped.WriteByte('{')
+	writeJSON(wrapped, rootWrapper)
+	wrapped.WriteByte(':')
+	wrapped.Write(buf)
+	wrapped.WriteByte('}')
+	return wrapped.Bytes(), nil
+}
+
+// marshalEvent returns the logstash json event with the configured layout.
+func marshalEvent(log *logJSON) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	if !OmitSourceHost {
+		buf.WriteString(`"@source_host":`)
+		if err := writeJSON(buf, log.SourceHost); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"@timestamp":`)
+	var timestamp interface{} = log.TimeStamp
+	if ESCompatTimestamps {
+		timestamp = log.TimeStamp.Format(esTimestampLayout)
+	}
+	if err := writeJSON(buf, timestamp); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(',')
+	writeJSON(buf, fieldsKey)
+	buf.WriteString(`:{`)
+	for i, key := range orderedKeys(log.Fields) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSON(buf, key)
+		buf.WriteByte(':')
+		if err := writeJSON(buf, log.Fields[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	if len(labels) > 0 {
+		buf.WriteString(`,"labels":`)
+		if err := writeJSON(buf, labels); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString(`,"message":`)
+	if err := writeJSON(buf, log.Message); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes the JSON encoding of the value.
+func writeJSON(buf *bytes.Buffer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// orderedKeys returns the keys of the fields, those of fieldOrder first.
+func orderedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	listed := map[string]bool{}
+	for _, each := range fieldOrder {
+		if _, ok := fields[each]; ok && !listed[each] {
+			keys = append(keys, each)
+			listed[each] = true
+		}
+	}
+	rest := []string{}
+	for each := range fields {
+		if !listed[each] {
+			rest = append(rest, each)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// UnmarshalJSON decodes a logstash json event. The fields are read from
+// the @fields object or the object with the key set by SetFieldsKey.
+// An event nested under the key set by SetRootWrapper is unwrapped.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if wrapped, ok := raw[rootWrapper]; ok && rootWrapper != "" && len(raw) == 1 {
+		raw = nil
+		if err := json.Unmarshal(wrapped, &raw); err != nil {
+			return err
+		}
+	}
+	decoded := logJSON{}
+	for key, target := range map[string]interface{}{
+		"@source_host": &decoded.SourceHost,
+		"@timestamp":   &decoded.TimeStamp,
+		"message":      &decoded.Message,
+	} {
+		if value, ok := raw[key]; ok {
+			if err := json.Unmarshal(value, target); err != nil {
+				return err
+			}
+		}
+	}
+	fields, ok := raw[fieldsKey]
+	if !ok {
+		fields = raw["@fields"]
+	}
+	if fields != nil {
+		if err := json.Unmarshal(fields, &decoded.Fields); err != nil {
+			return err
+		}
+	}
+	*e = Event(decoded)
+	return nil
+}
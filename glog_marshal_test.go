@@ -0,0 +1,222 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -v -test.run TestSetFieldOrder ...glog
+func TestSetFieldOrder(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, 678901000, time.Local)
+	}
+	defer SetFieldOrder(nil)
+	SetFieldOrder([]string{"file", "line", "level", "missing"})
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"zone": "eu", "app": "glog"}
+
+	buf, err := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] ordered\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"@source_host":"` + host + `","@timestamp":"` + timeNow().Format(time.RFC3339Nano) + `",` +
+		`"@fields":{"file":"a.go","line":10,"level":"INFO","app":"glog","threadid":"12345","zone":"eu"},` +
+		`"message":"ordered"}`
+	if got := string(buf); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+// go test -v -test.run TestSetFieldsKey ...glog
+func TestSetFieldsKey(t *testing.T) {
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] renamed\n")
+	standard, _ := WriteWithStack(line, nil)
+
+	defer SetFieldsKey("@fields")
+	SetFieldsKey("metadata")
+	renamed, err := WriteWithStack(line, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := decodeEvent(t, renamed)
+	if _, ok := event["@fields"]; ok {
+		t.Error("expected no @fields")
+	}
+	if fields, ok := event["metadata"].(map[string]interface{}); !ok || fields["level"] != "WARNING" {
+		t.Errorf("expected fields in metadata, got %v", event["metadata"])
+	}
+
+	for _, each := range [][]byte{standard, renamed} {
+		decoded := new(Event)
+		if err := json.Unmarshal(each, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Fields["file"] != "a.go" || decoded.Message != "renamed" {
+			t.Errorf("unexpected decoded event %+v", decoded)
+		}
+	}
+}
+
+// go test -v -test.run TestSetRootWrapper ...glog
+func TestSetRootWrapper(t *testing.T) {
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] wrapped\n")
+	unwrapped := decodeEvent(t, mustWrite(t, line))
+	if unwrapped["message"] != "wrapped" {
+		t.Fatalf("expected an unwrapped event, got %v", unwrapped)
+	}
+
+	defer SetRootWrapper("")
+	SetRootWrapper("log")
+	buf := mustWrite(t, line)
+	wrapper := decodeEvent(t, buf)
+	if len(wrapper) != 1 {
+		t.Fatalf("expected only the wrapper key, got %v", wrapper)
+	}
+	event, ok := wrapper["log"].(map[string]interface{})
+	if !ok || event["message"] != "wrapped" || eventFields(t, event)["level"] != "WARNING" {
+		t.Errorf("expected the event under log, got %v", wrapper)
+	}
+	decoded := new(Event)
+	if err := json.Unmarshal(buf, decoded); err != nil || decoded.Message != "wrapped" {
+		t.Errorf("expected the wrapped event to decode, got %+v, %v", decoded, err)
+	}
+}
+
+// mustWrite returns the encoded event for the glog line.
+func mustWrite(t *testing.T, line []byte) []byte {
+	buf, err := WriteWithStack(line, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// go test -v -test.run TestFallbackToStdJSON ...glog
+func TestFallbackToStdJSON(t *testing.T) {
+	defer func(previous func(*logJSON) ([]byte, error)) { ffjsonMarshal = previous }(ffjsonMarshal)
+	ffjsonMarshal = func(*logJSON) ([]byte, error) { return nil, errors.New("simulated fail") }
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] exotic\n")
+
+	before := StdJSONFallbacks()
+	event := decodeEvent(t, mustWrite(t, line))
+	if event["message"] != "exotic" || eventFields(t, event)["level"] != "WARNING" {
+		t.Errorf("expected the event from the fallback, got %v", event)
+	}
+	if got := StdJSONFallbacks(); got != before+1 {
+		t.Errorf("expected %d fallbacks, got %d", before+1, got)
+	}
+
+	FallbackToStdJSON = false
+	defer func() { FallbackToStdJSON = true }()
+	if _, err := WriteWithStack(line, nil); err == nil {
+		t.Error("expected the marshal error without fallback")
+	}
+}
+
+// go test -v -test.run TestSetLabels ...glog
+func TestSetLabels(t *testing.T) {
+	defer SetLabels(nil)
+	SetLabels(map[string]string{"team": "payments", "tier": "1"})
+	event := decodeEvent(t, mustWrite(t, []byte("W0102 15:04:05.678901 12345 a.go:10] labeled\n")))
+	labels, ok := event["labels"].(map[string]interface{})
+	if !ok || labels["team"] != "payments" || labels["tier"] != "1" {
+		t.Errorf("expected string labels, got %v", event["labels"])
+	}
+	fields := eventFields(t, event)
+	if _, ok := fields["team"]; ok || fields["level"] != "WARNING" {
+		t.Errorf("expected labels apart from fields, got %v", fields)
+	}
+
+	SetLabels(nil)
+	if event := decodeEvent(t, mustWrite(t, []byte("W0102 15:04:05.678901 12345 a.go:10] unlabeled\n"))); event["labels"] != nil {
+		t.Errorf("expected no labels, got %v", event["labels"])
+	}
+}
+
+// go test -v -test.run TestOmitSourceHost ...glog
+func TestOmitSourceHost(t *testing.T) {
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] hosted\n")
+	if event := decodeEvent(t, mustWrite(t, line)); event["@source_host"] != host {
+		t.Errorf("expected @source_host %q by default, got %v", host, event["@source_host"])
+	}
+
+	OmitSourceHost = true
+	defer func() { OmitSourceHost = false }()
+	event := decodeEvent(t, mustWrite(t, line))
+	if _, ok := event["@source_host"]; ok {
+		t.Errorf("expected no @source_host, got %v", event)
+	}
+	if event["message"] != "hosted" || event["@timestamp"] == nil {
+		t.Errorf("expected the other fields, got %v", event)
+	}
+}
+
+// go test -v -test.run TestESCompatTimestamps ...glog
+func TestESCompatTimestamps(t *testing.T) {
+	ESCompatTimestamps = true
+	defer func() { ESCompatTimestamps = false }()
+	defer SetBaseYear(0)
+	SetBaseYear(2006)
+	for _, each := range []struct {
+		micros   string
+		expected time.Time
+	}{
+		{"678901", time.Date(2006, 1, 2, 15, 4, 5, 678000000, time.Local)},
+		{"600000", time.Date(2006, 1, 2, 15, 4, 5, 600000000, time.Local)},
+		{"000000", time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)},
+	} {
+		line := []byte("I0102 15:04:05." + each.micros + " 12345 a.go:10] indexed\n")
+		got, _ := decodeEvent(t, mustWrite(t, line))["@timestamp"].(string)
+		if expected := each.expected.Format("2006-01-02T15:04:05.000Z07:00"); got != expected {
+			t.Errorf("expected @timestamp %s, got %s", expected, got)
+		}
+		if dot := strings.IndexByte(got, '.'); dot == -1 || strings.IndexAny(got[dot+1:], "Z+-") != 3 {
+			t.Errorf("expected three fractional digits, got %s", got)
+		}
+	}
+}
+
+// go test -v -test.run TestSetFieldKeys ...glog
+func TestSetFieldKeys(t *testing.T) {
+	defer SetFieldKeys(FieldKeys{})
+	SetFieldKeys(FieldKeys{Level: "severity", ThreadID: "thread_id"})
+	fields := eventFields(t, decodeEvent(t, mustWrite(t, []byte("W0102 15:04:05.678901 12345 a.go:10] renamed\n"))))
+	for key, expected := range map[string]interface{}{
+		"severity":  "WARNING",
+		"thread_id": "12345",
+		"file":      "a.go",
+		"line":      float64(10),
+		"level":     nil,
+		"threadid":  nil,
+	} {
+		if got := fields[key]; got != expected {
+			t.Errorf("%s: expected %v, got %v", key, expected, got)
+		}
+	}
+
+	SetFieldKeys(FieldKeys{})
+	fields = eventFields(t, decodeEvent(t, mustWrite(t, []byte("W0102 15:04:05.678901 12345 a.go:10] default\n"))))
+	if fields["level"] != "WARNING" || fields["threadid"] != "12345" {
+		t.Errorf("expected the default keys, got %v", fields)
+	}
+}
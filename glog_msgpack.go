@@ -0,0 +1,241 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// MsgpackWriter decodes each glog line written to it and writes the event as MessagePack,
+// which is more compact than JSON. The keys are the same as for logstash json events;
+// @timestamp is written as the timestamp extension type.
+type MsgpackWriter struct {
+	writer io.Writer
+}
+
+// NewMsgpackWriter returns a MsgpackWriter that writes events to w.
+// Use it as the writer of an EventFormat Sink to receive the decoded events.
+func NewMsgpackWriter(w io.Writer) *MsgpackWriter {
+	return &MsgpackWriter{w}
+}
+
+// Write is for implementing io.Writer. It decodes the glog line into an Event.
+func (m *MsgpackWriter) Write(data []byte) (n int, err error) {
+	log, _ := parseEvent(data, nil)
+	if err := m.WriteEvent((*Event)(log)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteEvent writes the MessagePack encoding of the event.
+func (m *MsgpackWriter) WriteEvent(event *Event) error {
+	_, err := m.writer.Write(appendMsgpackEvent(nil, event))
+	return err
+}
+
+// appendMsgpackEvent appends the event as a map with the keys of the logstash json event.
+func appendMsgpackEvent(buf []byte, event *Event) []byte {
+	buf = appendMsgpackHeader(buf, 0x80, 0xde, 4)
+	buf = appendMsgpackString(buf, 0xd9, "@source_host")
+	buf = appendMsgpackString(buf, 0xd9, event.SourceHost)
+	buf = appendMsgpackString(buf, 0xd9, "@timestamp")
+	buf = appendMsgpackTime(buf, event.TimeStamp)
+	buf = appendMsgpackString(buf, 0xd9, "@fields")
+	buf = appendMsgpackValue(buf, event.Fields)
+	buf = appendMsgpackString(buf, 0xd9, "message")
+	return appendMsgpackString(buf, 0xd9, event.Message)
+}
+
+// appendMsgpackValue appends the value in its most compact encoding. Map keys are sorted.
+// A value of another type is encoded as its JSON encoding would decode, e.g. a time.Duration as int.
+func appendMsgpackValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if v {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case int:
+		return appendMsgpackInt(buf, int64(v))
+	case int8:
+		return appendMsgpackInt(buf, int64(v))
+	case int16:
+		return appendMsgpackInt(buf, int64(v))
+	case int32:
+		return appendMsgpackInt(buf, int64(v))
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case uint:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint8:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint16:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint32:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint64:
+		return appendMsgpackUint(buf, v)
+	case float32:
+		return appendMsgpackFixed(append(buf, 0xca), uint64(math.Float32bits(v)), 4)
+	case float64:
+		return appendMsgpackFixed(append(buf, 0xcb), math.Float64bits(v), 8)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(buf, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpackValue(buf, f)
+	case string:
+		return appendMsgpackString(buf, 0xd9, v)
+	case []byte:
+		return appendMsgpackString(buf, 0xc4, string(v))
+	case time.Time:
+		return appendMsgpackTime(buf, v)
+	case []string:
+		buf = appendMsgpackHeader(buf, 0x90, 0xdc, len(v))
+		for _, each := range v {
+			buf = appendMsgpackString(buf, 0xd9, each)
+		}
+		return buf
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, 0x90, 0xdc, len(v))
+		for _, each := range v {
+			buf = appendMsgpackValue(buf, each)
+		}
+		return buf
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = appendMsgpackHeader(buf, 0x80, 0xde, len(v))
+		for _, k := range keys {
+			buf = appendMsgpackString(appendMsgpackString(buf, 0xd9, k), 0xd9, v[k])
+		}
+		return buf
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = appendMsgpackHeader(buf, 0x80, 0xde, len(v))
+		for _, k := range keys {
+			buf = appendMsgpackValue(appendMsgpackString(buf, 0xd9, k), v[k])
+		}
+		return buf
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return append(buf, 0xc0)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var decoded interface{}
+	decoder.Decode(&decoded)
+	return appendMsgpackValue(buf, decoded)
+}
+
+// appendMsgpackInt appends a negative fixint or the smallest int encoding; positive values are uints.
+func appendMsgpackInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(buf, uint64(v))
+	case v >= -32:
+		return append(buf, byte(v))
+	case v >= math.MinInt8:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return appendMsgpackFixed(append(buf, 0xd1), uint64(v), 2)
+	case v >= math.MinInt32:
+		return appendMsgpackFixed(append(buf, 0xd2), uint64(v), 4)
+	}
+	return appendMsgpackFixed(append(buf, 0xd3), uint64(v), 8)
+}
+
+// appendMsgpackUint appends a positive fixint or the smallest uint encoding.
+func appendMsgpackUint(buf []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(buf, byte(v))
+	case v <= math.MaxUint8:
+		return append(buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return appendMsgpackFixed(append(buf, 0xcd), v, 2)
+	case v <= math.MaxUint32:
+		return appendMsgpackFixed(append(buf, 0xce), v, 4)
+	}
+	return appendMsgpackFixed(append(buf, 0xcf), v, 8)
+}
+
+// appendMsgpackString appends a str (code 0xd9) or bin (code 0xc4) with the smallest length;
+// the 16 and 32 bit lengths have the next codes. Short strings are fixstr.
+func appendMsgpackString(buf []byte, code byte, s string) []byte {
+	switch n := len(s); {
+	case code == 0xd9 && n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, code, byte(n))
+	case n <= math.MaxUint16:
+		buf = appendMsgpackFixed(append(buf, code+1), uint64(n), 2)
+	default:
+		buf = appendMsgpackFixed(append(buf, code+2), uint64(n), 4)
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackHeader appends the header of an array (0x90, 0xdc) or map (0x80, 0xde) of n elements.
+func appendMsgpackHeader(buf []byte, fixed, code byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fixed|byte(n))
+	case n <= math.MaxUint16:
+		return appendMsgpackFixed(append(buf, code), uint64(n), 2)
+	}
+	return appendMsgpackFixed(append(buf, code+1), uint64(n), 4)
+}
+
+// appendMsgpackTime appends the time as the timestamp extension type (-1),
+// in the 32, 64 or 96 bit format.
+func appendMsgpackTime(buf []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec>>34 != 0:
+		buf = appendMsgpackFixed(append(buf, 0xc7, 12, 0xff), nsec, 4)
+		return appendMsgpackFixed(buf, uint64(sec), 8)
+	case nsec == 0 && sec <= math.MaxUint32:
+		return appendMsgpackFixed(append(buf, 0xd6, 0xff), uint64(sec), 4)
+	}
+	return appendMsgpackFixed(append(buf, 0xd7, 0xff), nsec<<34|uint64(sec), 8)
+}
+
+// appendMsgpackFixed appends the size lowest bytes of the value, big-endian.
+func appendMsgpackFixed(buf []byte, v uint64, size int) []byte {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], v)
+	return append(buf, encoded[8-size:]...)
+}
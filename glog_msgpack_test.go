@@ -0,0 +1,83 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -v -test.run TestMsgpackWriter ...glog
+func TestMsgpackWriter(t *testing.T) {
+	packed := new(bytes.Buffer)
+	writer := NewMsgpackWriter(packed)
+	event := &Event{
+		SourceHost: "h",
+		TimeStamp:  time.Unix(1, 0),
+		Fields:     map[string]interface{}{"n": 1, "s": "x"},
+		Message:    "m",
+	}
+	if err := writer.WriteEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("\x84" +
+		"\xac@source_host\xa1h" +
+		"\xaa@timestamp\xd6\xff\x00\x00\x00\x01" +
+		"\xa7@fields\x82\xa1n\x01\xa1s\xa1x" +
+		"\xa7message\xa1m")
+	if got := packed.Bytes(); !bytes.Equal(got, expected) {
+		t.Errorf("expected %x, got %x", expected, got)
+	}
+
+	packed.Reset()
+	if _, err := writer.Write([]byte("W0102 15:04:05.678901 12345 a.go:10] packed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(packed.Bytes(), []byte("\xa5level\xa7WARNING")) {
+		t.Errorf("expected the level field, got %x", packed.Bytes())
+	}
+}
+
+// go test -v -test.run TestMsgpackValue ...glog
+func TestMsgpackValue(t *testing.T) {
+	for _, each := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "\xc0"},
+		{true, "\xc3"},
+		{-1, "\xff"},
+		{-33, "\xd0\xdf"},
+		{200, "\xcc\xc8"},
+		{int64(-40000), "\xd2\xff\xff\x63\xc0"},
+		{uint64(1 << 32), "\xcf\x00\x00\x00\x01\x00\x00\x00\x00"},
+		{1.5, "\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00"},
+		{strings.Repeat("a", 32), "\xd9\x20" + strings.Repeat("a", 32)},
+		{[]byte("b"), "\xc4\x01b"},
+		{[]string{"a"}, "\x91\xa1a"},
+		{map[string]string{"b": "2", "a": "1"}, "\x82\xa1a\xa11\xa1b\xa12"},
+		{5 * time.Millisecond, "\xce\x00\x4c\x4b\x40"}, // as JSON
+		{time.Unix(1, 2), "\xd7\xff\x00\x00\x00\x08\x00\x00\x00\x01"},
+		{time.Unix(-1, 0), "\xc7\x0c\xff\x00\x00\x00\x00\xff\xff\xff\xff\xff\xff\xff\xff"},
+	} {
+		if got := appendMsgpackValue(nil, each.value); string(got) != each.expected {
+			t.Errorf("%v: expected %x, got %x", each.value, each.expected, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LinePolicy identifies what ParseEvents does with a line that is not a JSON event.
+type LinePolicy int
+
+const (
+	SkipMalformedLines    LinePolicy = iota // the line is ignored
+	CollectMalformedLines                   // the line is reported in a *MalformedLinesError
+)
+
+// MalformedLinePolicy is applied by ParseEvents and ParseFile to lines that cannot be decoded.
+var MalformedLinePolicy = SkipMalformedLines
+
+// MalformedLine is a line that could not be decoded into an Event.
+type MalformedLine struct {
+	Number int // of the first line of the event, from 1
+	Data   string
+	Err    error
+}
+
+// MalformedLinesError is returned, after all events are parsed, when lines were collected.
+type MalformedLinesError struct {
+	Lines []MalformedLine
+}
+
+// Error is for implementing error.
+func (m *MalformedLinesError) Error() string {
+	return fmt.Sprintf("%d malformed lines, first at line %d: %v", len(m.Lines), m.Lines[0].Number, m.Lines[0].Err)
+}
+
+// ParseFile reads a file with JSON events, as written by the Logstash writer, and returns
+// the decoded events. Use ParseEvents for files that are too large to hold.
+func ParseFile(path string) ([]*Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	events := []*Event{}
+	err = ParseEvents(file, func(event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// ParseEvents reads newline delimited JSON events and calls the callback for each decoded event.
+// An event may span several lines, as written when @fields is followed by a newline or when it
+// is indented (see PrettyAboveSeverity): lines continue the event until its object is closed.
+// A line that starts with "{" always starts a new event. Parsing stops at the first error of the callback.
+func ParseEvents(reader io.Reader, callback func(*Event) error) error {
+	malformed := []MalformedLine{}
+	var record []byte
+	var depth jsonDepth
+	number, recordNumber := 0, 0
+	flush := func() error {
+		if len(bytes.TrimSpace(record)) == 0 {
+			return nil
+		}
+		event := new(Event)
+		if err := json.Unmarshal(record, event); err != nil {
+			if MalformedLinePolicy == CollectMalformedLines {
+				malformed = append(malformed, MalformedLine{recordNumber, string(record), err})
+			}
+			return nil
+		}
+		return callback(event)
+	}
+	lines := bufio.NewReader(reader)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 {
+			number++
+			if len(record) > 0 && line[0] != '{' && (depth.open > 0 || line[0] == ',') {
+				record = append(record, line...)
+				depth.scan(line)
+			} else {
+				if err := flush(); err != nil {
+					return err
+				}
+				record, recordNumber = line, number
+				depth = jsonDepth{}
+				if line[0] == '{' { // other lines are not continued
+					depth.scan(line)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if len(malformed) > 0 {
+		return &MalformedLinesError{malformed}
+	}
+	return nil
+}
+
+// jsonDepth tracks the objects and arrays that are open in JSON read so far.
+type jsonDepth struct {
+	open     int
+	inString bool
+	escaped  bool
+}
+
+// scan updates the depth with the data.
+func (j *jsonDepth) scan(data []byte) {
+	for _, each := range data {
+		switch {
+		case j.escaped:
+			j.escaped = false
+		case j.inString:
+			j.escaped = each == '\\'
+			j.inString = each != '"'
+		case each == '"':
+			j.inString = true
+		case each == '{' || each == '[':
+			j.open++
+		case each == '}' || each == ']':
+			j.open--
+		}
+	}
+}
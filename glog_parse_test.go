@@ -0,0 +1,99 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v -test.run TestParseFile ...glog
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sample := new(bytes.Buffer)
+	for _, each := range []string{"first", "second"} {
+		buf, _ := WriteWithStack([]byte("W0102 15:04:05.678901 12345 a.go:10] "+each+"\n"), nil)
+		sample.Write(buf)
+		sample.WriteString("\n")
+	}
+	sample.WriteString("not json\n")
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] third\n"), nil)
+	sample.Write(buf)
+	path := filepath.Join(dir, "events.json")
+	ioutil.WriteFile(path, sample.Bytes(), 0644)
+
+	events, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if events[0].Message != "first" || events[2].Message != "third" || events[2].Fields["level"] != "ERROR" {
+		t.Errorf("unexpected events %v %v", events[0], events[2])
+	}
+
+	MalformedLinePolicy = CollectMalformedLines
+	defer func() { MalformedLinePolicy = SkipMalformedLines }()
+	events, err = ParseFile(path)
+	malformed, ok := err.(*MalformedLinesError)
+	if !ok {
+		t.Fatalf("expected a MalformedLinesError, got %v", err)
+	}
+	if len(events) != 3 || len(malformed.Lines) != 1 || malformed.Lines[0].Data != "not json\n" {
+		t.Errorf("expected 3 events and the collected line, got %d and %v", len(events), malformed.Lines)
+	}
+}
+
+// go test -v -test.run TestParseEventsIndented ...glog
+func TestParseEventsIndented(t *testing.T) {
+	PrettyAboveSeverity = InfoSeverity
+	defer func() { PrettyAboveSeverity = FatalSeverity }()
+	sample := new(bytes.Buffer)
+	for _, each := range []string{
+		"W0102 15:04:05.678901 12345 a.go:10] unbalanced } in \"quotes\"\n",
+		"I0102 15:04:05.678901 12345 a.go:11] not indented\n",
+		"E0102 15:04:05.678901 12345 a.go:12] last\n",
+	} {
+		buf, _ := WriteWithStack([]byte(each), sampleStack)
+		sample.Write(buf)
+		sample.WriteString("\n")
+	}
+	if lines := bytes.Count(sample.Bytes(), []byte("\n")); lines < 10 {
+		t.Fatalf("expected indented events, got %d lines", lines)
+	}
+	events := []*Event{}
+	MalformedLinePolicy = CollectMalformedLines
+	defer func() { MalformedLinePolicy = SkipMalformedLines }()
+	err := ParseEvents(sample, func(event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Message != `unbalanced } in "quotes"` || events[2].Fields["stack"] != string(sampleStack) {
+		t.Errorf("unexpected events %v", events)
+	}
+}
@@ -0,0 +1,132 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// EventProto is the protobuf encoding of an Event. It mirrors:
+//
+//	message Event {
+//	  string source_host = 1;
+//	  int64 timestamp_nanos = 2;
+//	  string message = 3;
+//	  map<string, string> fields = 4;
+//	}
+//
+// Field values that are not strings are written in their JSON encoding.
+type EventProto struct {
+	SourceHost     string            `json:"source_host,omitempty"`
+	TimestampNanos int64             `json:"timestamp_nanos,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Fields         map[string]string `json:"fields,omitempty"`
+}
+
+// newEventProto returns the protobuf message for an event.
+func newEventProto(event *Event) *EventProto {
+	m := &EventProto{
+		SourceHost:     event.SourceHost,
+		TimestampNanos: event.TimeStamp.UnixNano(),
+		Message:        event.Message,
+		Fields:         make(map[string]string, len(event.Fields)),
+	}
+	for k, v := range event.Fields {
+		if s, ok := v.(string); ok {
+			m.Fields[k] = s
+		} else if encoded, err := json.Marshal(v); err == nil {
+			m.Fields[k] = string(encoded)
+		}
+	}
+	return m
+}
+
+// Marshal returns the protobuf wire encoding of the message. Default values are omitted
+// and the fields are ordered by key, as by a deterministic proto3 encoder.
+func (m *EventProto) Marshal() []byte {
+	var buf []byte
+	buf = appendProtoString(buf, 1, m.SourceHost)
+	if m.TimestampNanos != 0 {
+		buf = appendVarint(append(buf, 2<<3), uint64(m.TimestampNanos))
+	}
+	buf = appendProtoString(buf, 3, m.Message)
+	keys := make([]string, 0, len(m.Fields))
+	for k := range m.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// a map entry is a message with the key and the value
+		var entry []byte
+		entry = appendProtoBytes(entry, 1, k)
+		entry = appendProtoBytes(entry, 2, m.Fields[k])
+		buf = appendProtoBytes(buf, 4, string(entry))
+	}
+	return buf
+}
+
+// appendProtoString appends the length-delimited field unless the value is empty.
+func appendProtoString(buf []byte, field int, value string) []byte {
+	if value == "" {
+		return buf
+	}
+	return appendProtoBytes(buf, field, value)
+}
+
+// appendProtoBytes appends the length-delimited field.
+func appendProtoBytes(buf []byte, field int, value string) []byte {
+	buf = appendVarint(buf, uint64(field<<3|2))
+	buf = appendVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// appendVarint appends the base 128 varint encoding of the value.
+func appendVarint(buf []byte, value uint64) []byte {
+	var encoded [binary.MaxVarintLen64]byte
+	return append(buf, encoded[:binary.PutUvarint(encoded[:], value)]...)
+}
+
+// ProtobufWriter decodes each glog line written to it and writes the event as an EventProto,
+// prefixed by its length as a varint, for streaming collectors.
+type ProtobufWriter struct {
+	writer io.Writer
+}
+
+// NewProtobufWriter returns a ProtobufWriter that writes events to w.
+// Use it as the writer of an EventFormat Sink to receive the decoded events.
+func NewProtobufWriter(w io.Writer) *ProtobufWriter {
+	return &ProtobufWriter{w}
+}
+
+// Write is for implementing io.Writer. It decodes the glog line into an Event.
+func (p *ProtobufWriter) Write(data []byte) (n int, err error) {
+	log, _ := parseEvent(data, nil)
+	if err := p.WriteEvent((*Event)(log)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteEvent writes the length prefixed protobuf encoding of the event.
+func (p *ProtobufWriter) WriteEvent(event *Event) error {
+	buf := newEventProto(event).Marshal()
+	_, err := p.writer.Write(append(appendVarint(nil, uint64(len(buf))), buf...))
+	return err
+}
@@ -0,0 +1,111 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// protoFields decodes protobuf wire data into the varint and length-delimited values by field number.
+func protoFields(t *testing.T, data []byte) (map[uint64]uint64, map[uint64][]string) {
+	varints, delimited := map[uint64]uint64{}, map[uint64][]string{}
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		data = data[n:]
+		value, n := binary.Uvarint(data)
+		data = data[n:]
+		switch {
+		case tag&7 == 0:
+			varints[tag>>3] = value
+		case tag&7 == 2 && int(value) <= len(data):
+			delimited[tag>>3] = append(delimited[tag>>3], string(data[:value]))
+			data = data[value:]
+		default:
+			t.Fatalf("invalid field %d", tag>>3)
+		}
+	}
+	return varints, delimited
+}
+
+// unmarshalEventProto decodes the protobuf wire encoding of an EventProto.
+func unmarshalEventProto(t *testing.T, data []byte) *EventProto {
+	varints, delimited := protoFields(t, data)
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+	m := &EventProto{
+		SourceHost:     first(delimited[1]),
+		TimestampNanos: int64(varints[2]),
+		Message:        first(delimited[3]),
+		Fields:         map[string]string{},
+	}
+	for _, each := range delimited[4] {
+		_, entry := protoFields(t, []byte(each))
+		m.Fields[first(entry[1])] = first(entry[2])
+	}
+	return m
+}
+
+// go test -v -test.run TestProtobufWriter ...glog
+func TestProtobufWriter(t *testing.T) {
+	framed := new(bytes.Buffer)
+	writer := NewProtobufWriter(framed)
+	for _, each := range []string{"first", "second"} {
+		if _, err := writer.Write([]byte("W0102 15:04:05.678901 12345 a.go:10] " + each + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream := framed.Bytes()
+	for _, expected := range []string{"first", "second"} {
+		size, n := binary.Uvarint(stream)
+		if n <= 0 || n+int(size) > len(stream) {
+			t.Fatalf("invalid frame length %d", size)
+		}
+		event := unmarshalEventProto(t, stream[n:n+int(size)])
+		stream = stream[n+int(size):]
+		if event.Message != expected || event.SourceHost != host {
+			t.Errorf("expected message %q from %q, got %v", expected, host, event)
+		}
+		for key, value := range map[string]string{"level": "WARNING", "file": "a.go", "line": "10"} {
+			if got := event.Fields[key]; got != value {
+				t.Errorf("%s: expected %q, got %q", key, value, got)
+			}
+		}
+	}
+	if len(stream) != 0 {
+		t.Errorf("expected no trailing bytes, got %d", len(stream))
+	}
+}
+
+// go test -v -test.run TestEventProtoMarshal ...glog
+func TestEventProtoMarshal(t *testing.T) {
+	m := &EventProto{SourceHost: "h", TimestampNanos: 300, Fields: map[string]string{"b": "2", "a": ""}}
+	expected := []byte{
+		0x0a, 1, 'h', // source_host
+		0x10, 0xac, 0x02, // timestamp_nanos
+		0x22, 5, 0x0a, 1, 'a', 0x12, 0, // fields, ordered by key
+		0x22, 6, 0x0a, 1, 'b', 0x12, 1, '2',
+	}
+	if got := m.Marshal(); !bytes.Equal(got, expected) {
+		t.Errorf("expected %x, got %x", expected, got)
+	}
+}
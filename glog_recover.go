@@ -0,0 +1,82 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// RecoverSeverity is the severity of the events written by RecoverAndLog.
+var RecoverSeverity = FatalSeverity
+
+// RepanicAfterRecover makes RecoverAndLog panic again after the event is written.
+var RepanicAfterRecover = false
+
+// RecoverAndLog recovers a panic and writes an event with the panic value and the stack
+// of the goroutine to the Logstash writer, which is flushed. If publishing is not enabled,
+// the glog line and the stack are written to Stderr instead. It must be called using defer:
+//
+//	defer glog.RecoverAndLog()
+//
+// It takes the lock of the logging configuration. A panic raised while logging holds that lock,
+// e.g. in a hook, Formatter, severity inference function or sink, leaves it locked, so
+// RecoverAndLog would deadlock; do not use it to recover such panics.
+func RecoverAndLog() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := make([]byte, 64<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+	file, line := panicLocation(stack)
+	buf := logging.formatHeader(severity(RecoverSeverity), file, line)
+	fmt.Fprintf(buf, "panic: %v\n", r)
+
+	logging.mu.Lock()
+	if logstash.enabled() {
+		logstash.WriteWithStack(buf.Bytes(), stack)
+		logstash.flush()
+	} else {
+		// make sure the panic appears somewhere
+		os.Stderr.Write(buf.Bytes())
+		os.Stderr.Write(stack)
+		if RecoverSeverity == FatalSeverity && fatalSink != nil {
+			writeFatalWithStack(buf.Bytes(), stack)
+		}
+	}
+	logging.mu.Unlock()
+	logging.putBuffer(buf)
+
+	if RepanicAfterRecover {
+		panic(r)
+	}
+}
+
+// panicLocation returns the file name and line of the frame that called panic.
+func panicLocation(stack []byte) (string, int) {
+	frames := parseStack(stack)
+	for i, each := range frames {
+		if strings.HasPrefix(each.Function, "panic(") && i+1 < len(frames) {
+			return filepath.Base(frames[i+1].File), frames[i+1].Line
+		}
+	}
+	return "???", 1
+}
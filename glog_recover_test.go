@@ -0,0 +1,97 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func panicking() {
+	defer RecoverAndLog()
+	panic("boom")
+}
+
+// go test -v -test.run TestRecoverAndLog ...glog
+func TestRecoverAndLog(t *testing.T) {
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- true }()
+		panicking()
+	}()
+	<-done
+
+	event := decodeEvent(t, capture.Bytes())
+	if got := event["message"]; got != "panic: boom" {
+		t.Errorf("expected panic message, got %v", got)
+	}
+	fields := eventFields(t, event)
+	if got := fields["level"]; got != "FATAL" {
+		t.Errorf("expected level FATAL, got %v", got)
+	}
+	if got := fields["file"]; got != "glog_recover_test.go" {
+		t.Errorf("expected file of the panic, got %v", got)
+	}
+	if stack, _ := fields["stack"].(string); !strings.Contains(stack, "glog.panicking") {
+		t.Errorf("expected stack of the panicking goroutine, got %q", stack)
+	}
+}
+
+// go test -v -test.run TestRecoverAndLogRepanic ...glog
+func TestRecoverAndLogRepanic(t *testing.T) {
+	RepanicAfterRecover = true
+	defer func() { RepanicAfterRecover = false }()
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	SetLogstashWriter(new(bytes.Buffer))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected repanic with boom, got %v", r)
+		}
+	}()
+	panicking()
+}
+
+// go test -v -test.run TestRecoverAndLogNotPublishing ...glog
+func TestRecoverAndLogNotPublishing(t *testing.T) {
+	// other tests may leave publishing on
+	logstash.toLogstash = false
+	SetAlsoJSONTo(nil)
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	sink := new(bytes.Buffer)
+	SetFatalSink(sink)
+	defer SetFatalSink(nil)
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- true }()
+		panicking()
+	}()
+	<-done
+
+	if capture.Len() > 0 {
+		t.Errorf("expected nothing published, got %q", capture.String())
+	}
+	if got := decodeEvent(t, sink.Bytes())["message"]; got != "panic: boom" {
+		t.Errorf("expected the panic in the fatal sink, got %v", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// ReentrancyGuard drops events that are logged by the goroutine that is publishing an event,
+// e.g. by a hook or writer that logs on failure, which would otherwise block or recurse forever.
+// Dropped events are written to Stderr. It costs a stack read per published event.
+var ReentrancyGuard = false
+
+// publishingGoroutine is the id of the goroutine that publishes an event, or zero. Handled atomically.
+var publishingGoroutine int64
+
+// enterPublishing marks the calling goroutine as publishing; the returned func unmarks it.
+func enterPublishing() func() {
+	if !ReentrancyGuard {
+		return func() {}
+	}
+	atomic.StoreInt64(&publishingGoroutine, goroutineID())
+	return func() { atomic.StoreInt64(&publishingGoroutine, 0) }
+}
+
+// reentrant returns whether the calling goroutine is publishing an event.
+func reentrant() bool {
+	id := atomic.LoadInt64(&publishingGoroutine)
+	return id != 0 && id == goroutineID()
+}
+
+// dropReentrant writes an event that was logged while publishing to Stderr.
+func dropReentrant(data []byte) {
+	os.Stderr.WriteString("[glog error] dropped message logged while publishing:\n")
+	os.Stderr.Write(data)
+}
+
+// goroutineID returns the id of the calling goroutine, read from the "goroutine 123 [" stack header.
+func goroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if space := bytes.IndexByte(buf, 32); space != -1 {
+		buf = buf[:space]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,69 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// loggingHook logs for every event it sees.
+type loggingHook struct {
+	calls int
+}
+
+func (h *loggingHook) Name() string { return "logging" }
+
+func (h *loggingHook) Apply(event *Event) bool {
+	h.calls++
+	Warning("hook failed for ", event.Message)
+	return false
+}
+
+// go test -v -test.run TestReentrancyGuard ...glog
+func TestReentrancyGuard(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	ReentrancyGuard = true
+	defer func() { ReentrancyGuard = false }()
+	hook := new(loggingHook)
+	AddHook(hook)
+	defer func() { hooks = nil }()
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+
+	done := make(chan bool)
+	go func() {
+		Info("hello")
+		Flush()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging from a hook blocked")
+	}
+	if hook.calls != 1 {
+		t.Errorf("expected the hook to be called once, got %d", hook.calls)
+	}
+	if events := decodeEvents(t, capture.Bytes()); len(events) != 1 || events[0]["message"] != "hello" {
+		t.Errorf("expected only the hello event, got %v", events)
+	}
+}
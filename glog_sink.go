@@ -0,0 +1,257 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Format identifies how events are written to a Sink.
+type Format int
+
+const (
+	JSONFormat   Format = iota // logstash json events, one per line
+	TextFormat                 // the glog lines as is
+	SyslogFormat               // compact text lines, see RenderSyslogLine
+	EventFormat                // the decoded Event, see EventWriter
+)
+
+// EventWriter is implemented by the writer of an EventFormat Sink to receive each decoded Event,
+// such that it does not decode the glog line again. A writer that does not implement it
+// receives the glog lines as for the TextFormat.
+type EventWriter interface {
+	WriteEvent(event *Event) error
+}
+
+// Sink is an io.Writer for events in a Format.
+type Sink interface {
+	io.Writer
+	Format() Format
+}
+
+// formatWriter is a Sink for a Format.
+type formatWriter struct {
+	io.Writer
+	format Format
+}
+
+// Format is part of the Sink interface.
+func (f formatWriter) Format() Format {
+	return f.format
+}
+
+// eventSink is an EventFormat Sink whose writer is an EventWriter.
+type eventSink struct {
+	formatWriter
+	EventWriter
+}
+
+// NewSink returns a Sink that writes events in the format to the writer.
+func NewSink(writer io.Writer, format Format) Sink {
+	if events, ok := writer.(EventWriter); ok && format == EventFormat {
+		return eventSink{formatWriter{writer, format}, events}
+	}
+	return formatWriter{writer, format}
+}
+
+// AddSink registers a sink that receives each event written to the Logstash writer.
+// Events are decoded and encoded once, for all sinks.
+func AddSink(sink Sink) {
+	logging.mu.Lock()
+	logstash.sinks = append(logstash.sinks, &sinkWriter{sink, sink.Format(), newBufferedWriter(sink)})
+	logging.mu.Unlock()
+}
+
+// ReplaceSink replaces a sink registered with AddSink, e.g. on failover, without losing the events
+// that are buffered for it; see WriterSwapPolicy. It returns false if the sink is not registered.
+// Sinks are compared with ==, so a sink of a type that cannot be compared, e.g. a struct with
+// a slice, is never registered for it; use a pointer instead.
+func ReplaceSink(old, replacement Sink) bool {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	for _, each := range logstash.sinks {
+		if !sameSink(each.sink, old) {
+			continue
+		}
+		// buffered events are encoded in the format of the old sink
+		handOff := WriterSwapPolicy == HandOffOnSwap && replacement.Format() == each.format
+		each.writer = swapWriter(each.writer, replacement, handOff)
+		each.sink, each.format = replacement, replacement.Format()
+		return true
+	}
+	return false
+}
+
+// sameSink returns whether the sinks are equal; sinks that cannot be compared are not.
+func sameSink(registered, sink Sink) (same bool) {
+	defer func() {
+		if recover() != nil { // comparing uncomparable types panics
+			same = false
+		}
+	}()
+	return registered == sink
+}
+
+// SwapPolicy identifies what happens to the buffered events of a writer that is replaced.
+type SwapPolicy int
+
+const (
+	DrainOnSwap   SwapPolicy = iota // the buffered events are written to the replaced writer first
+	HandOffOnSwap                   // the buffered events are written to the new writer instead
+)
+
+// WriterSwapPolicy applies to the events buffered for a writer that is replaced by
+// SetLogstashWriter or ReplaceSink. A sink with another format always drains.
+var WriterSwapPolicy = DrainOnSwap
+
+// swapWriter returns the buffered writer that replaces the old one, which is drained
+// or hands off its buffered events.
+func swapWriter(old *bufferedWriter, writer io.Writer, handOff bool) *bufferedWriter {
+	swapped := newBufferedWriter(writer)
+	if old == nil {
+		return swapped
+	}
+	if handOff {
+		swapped.buffer, old.buffer = old.buffer, [][]byte{}
+		swapped.events, old.events = old.events, nil
+	} else {
+		old.flush()
+	}
+	return swapped
+}
+
+// sinkWriter buffers the events for a Sink until a flush.
+type sinkWriter struct {
+	sink   Sink // as registered, see ReplaceSink
+	format Format
+	writer *bufferedWriter
+}
+
+// write buffers the event in the format of the sink.
+func (s *sinkWriter) write(data []byte, log *logJSON, encoded []byte) {
+	switch s.format {
+	case TextFormat:
+		// data is owned by the caller
+		s.writer.Write(append([]byte{}, data...))
+	case SyslogFormat:
+		s.writer.Write([]byte(RenderSyslogLine((*Event)(log)) + "\n"))
+	case EventFormat:
+		// the event is shared with the other sinks
+		event := *log
+		event.Fields = make(map[string]interface{}, len(log.Fields))
+		for k, v := range log.Fields {
+			event.Fields[k] = v
+		}
+		if channel, ok := s.writer.writer.(*ChannelSink); ok {
+			// delivered when published, not when flushed
+			channel.WriteEvent((*Event)(&event))
+			return
+		}
+		s.writer.writeEvent(append([]byte{}, data...), (*Event)(&event))
+	default:
+		s.writer.Write(encoded)
+		s.writer.Write([]byte("\n"))
+	}
+}
+
+// OverflowPolicy identifies what a ChannelSink does with an event when its channel is full.
+type OverflowPolicy int
+
+const (
+	DropWhenFull  OverflowPolicy = iota // the event is dropped and counted
+	BlockWhenFull                       // the event is queued until the receiver takes it; logging does not wait
+)
+
+// ChannelSink is a Sink that sends each Event on a channel, such that the application
+// can intercept and re-route events. Events are sent when they are published, not when
+// the sinks are flushed. The receiver may log.
+type ChannelSink struct {
+	Policy     OverflowPolicy
+	events     chan *Event
+	dropped    int64
+	mu         sync.Mutex
+	queued     []*Event // waiting for the receiver, see BlockWhenFull
+	forwarding bool     // whether a goroutine sends the queued events
+}
+
+// NewChannelSink returns a ChannelSink and the channel, with buffer capacity, on which it sends events.
+// Register it using AddSink.
+func NewChannelSink(buffer int) (*ChannelSink, <-chan *Event) {
+	sink := &ChannelSink{events: make(chan *Event, buffer)}
+	return sink, sink.events
+}
+
+// Format is part of the Sink interface.
+func (c *ChannelSink) Format() Format {
+	return EventFormat
+}
+
+// Write is for implementing io.Writer. It decodes the glog line into an Event.
+func (c *ChannelSink) Write(data []byte) (n int, err error) {
+	log, _ := parseEvent(data, nil)
+	c.WriteEvent((*Event)(log))
+	return len(data), nil
+}
+
+// WriteEvent is part of the EventWriter interface. It never waits for the receiver,
+// because it is called while logging holds its lock.
+func (c *ChannelSink) WriteEvent(event *Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queued) == 0 { // keep the order of queued events
+		select {
+		case c.events <- event:
+			return nil
+		default:
+		}
+	}
+	if c.Policy != BlockWhenFull {
+		atomic.AddInt64(&c.dropped, 1)
+		return nil
+	}
+	c.queued = append(c.queued, event)
+	if !c.forwarding {
+		c.forwarding = true
+		go c.forward()
+	}
+	return nil
+}
+
+// forward sends the queued events, waiting for the receiver, until none is left.
+func (c *ChannelSink) forward() {
+	for {
+		c.mu.Lock()
+		if len(c.queued) == 0 {
+			c.forwarding = false
+			c.mu.Unlock()
+			return
+		}
+		event := c.queued[0]
+		c.mu.Unlock()
+		c.events <- event
+		c.mu.Lock()
+		c.queued = c.queued[1:]
+		c.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of events dropped because the channel was full.
+func (c *ChannelSink) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
@@ -0,0 +1,213 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// go test -v -test.run TestSinks ...glog
+func TestSinks(t *testing.T) {
+	defer func() { logstash.sinks = nil }()
+	jsonOut, textOut := new(bytes.Buffer), new(bytes.Buffer)
+	AddSink(NewSink(jsonOut, JSONFormat))
+	AddSink(NewSink(textOut, TextFormat))
+	SetLogstashWriter(new(bytes.Buffer))
+
+	line := "W0102 15:04:05.678901 12345 a.go:10] to all sinks\n"
+	logstash.WriteWithStack([]byte(line), nil)
+	logstash.flush()
+
+	if got := textOut.String(); got != line {
+		t.Errorf("expected text line %q, got %q", line, got)
+	}
+	event := decodeEvent(t, jsonOut.Bytes())
+	if got := event["message"]; got != "to all sinks" {
+		t.Errorf("expected json message, got %v", got)
+	}
+	if got := eventFields(t, event)["level"]; got != "WARNING" {
+		t.Errorf("expected json level WARNING, got %v", got)
+	}
+}
+
+// go test -v -test.run TestChannelSink ...glog
+func TestChannelSink(t *testing.T) {
+	sink, events := NewChannelSink(1)
+	sink.Write([]byte("W0102 15:04:05.678901 12345 a.go:10] first\n"))
+	sink.Write([]byte("W0102 15:04:05.678901 12345 a.go:10] second\n"))
+	if got := sink.Dropped(); got != 1 {
+		t.Errorf("expected 1 dropped event, got %d", got)
+	}
+	event := <-events
+	if event.Message != "first" || event.Fields["level"] != "WARNING" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// queued, in order, without waiting for the receiver
+	sink.Policy = BlockWhenFull
+	for _, each := range []string{"third", "fourth", "fifth"} {
+		sink.Write([]byte("I0102 15:04:05.678901 12345 a.go:10] " + each + "\n"))
+	}
+	for _, expected := range []string{"third", "fourth", "fifth"} {
+		if event := <-events; event.Message != expected {
+			t.Errorf("expected %s, got %q", expected, event.Message)
+		}
+	}
+	if got := sink.Dropped(); got != 1 {
+		t.Errorf("expected no more dropped events, got %d", got)
+	}
+}
+
+// go test -v -test.run TestChannelSinkAdded ...glog
+func TestChannelSinkAdded(t *testing.T) {
+	defer func() { logstash.sinks = nil }()
+	sink, events := NewChannelSink(4)
+	AddSink(sink)
+	SetLogstashWriter(new(bytes.Buffer))
+	logstash.WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] routed\n"), nil)
+	logstash.flush()
+	if event := <-events; event.Message != "routed" {
+		t.Errorf("expected routed, got %q", event.Message)
+	}
+}
+
+// go test -v -test.run TestEventSinkDecodedOnce ...glog
+func TestEventSinkDecodedOnce(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	defer func() { logstash.sinks = nil }()
+	EventID = true
+	sink, events := NewChannelSink(1)
+	AddSink(sink)
+	gelf := new(bytes.Buffer)
+	AddSink(NewSink(NewGELFWriter(gelf), EventFormat))
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	logstash.WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] once\n"), nil)
+	logstash.flush()
+
+	id := eventFields(t, decodeEvent(t, capture.Bytes()))["event_id"]
+	if event := <-events; event.Fields["event_id"] != id {
+		t.Errorf("expected event_id %v, got %v", id, event.Fields["event_id"])
+	}
+	if !bytes.Contains(gelf.Bytes(), []byte(`"_event_id":"`+id.(string)+`"`)) {
+		t.Errorf("expected event_id %v in %q", id, gelf.String())
+	}
+}
+
+// go test -v -test.run TestChannelSinkReceiverLogs ...glog
+func TestChannelSinkReceiverLogs(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func() { logstash.sinks = nil }()
+	logstash.toLogstash = true
+	defer func() { logstash.toLogstash = false }()
+	SetLogstashWriter(new(bytes.Buffer))
+	sink, events := NewChannelSink(1)
+	sink.Policy = BlockWhenFull
+	AddSink(sink)
+
+	received := make(chan bool)
+	go func() {
+		for event := range events {
+			if event.Message == "sent" {
+				Info("received") // needs the logging lock
+				received <- true
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		Info("sent")
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the receiver to log, got %d events", i)
+		}
+	}
+}
+
+// go test -v -test.run TestReplaceSink ...glog
+func TestReplaceSink(t *testing.T) {
+	defer func() { logstash.sinks = nil }()
+	defer func() { WriterSwapPolicy = DrainOnSwap }()
+	SetLogstashWriter(new(bytes.Buffer))
+	line := []byte("W0102 15:04:05.678901 12345 a.go:10] in flight\n")
+
+	for _, policy := range []SwapPolicy{DrainOnSwap, HandOffOnSwap} {
+		WriterSwapPolicy = policy
+		logstash.sinks = nil
+		primary, standby := new(bytes.Buffer), new(bytes.Buffer)
+		sink := NewSink(primary, JSONFormat)
+		AddSink(sink)
+		logstash.WriteWithStack(line, nil)
+		logstash.WriteWithStack(line, nil)
+		if !ReplaceSink(sink, NewSink(standby, JSONFormat)) {
+			t.Fatal("expected the sink to be replaced")
+		}
+		logstash.WriteWithStack(line, nil)
+		logstash.flush()
+
+		before, after := len(decodeEvents(t, primary.Bytes())), len(decodeEvents(t, standby.Bytes()))
+		if before+after != 3 {
+			t.Errorf("policy %d: expected no lost events, got %d and %d", policy, before, after)
+		}
+		if expected := map[SwapPolicy]int{DrainOnSwap: 2, HandOffOnSwap: 0}[policy]; before != expected {
+			t.Errorf("policy %d: expected %d events in the old sink, got %d", policy, expected, before)
+		}
+	}
+	if ReplaceSink(NewSink(new(bytes.Buffer), JSONFormat), NewSink(new(bytes.Buffer), JSONFormat)) {
+		t.Error("expected an unregistered sink not to be replaced")
+	}
+
+	// sinks that cannot be compared
+	logstash.sinks = nil
+	AddSink(sliceSink{})
+	sink := NewSink(new(bytes.Buffer), JSONFormat)
+	AddSink(sink)
+	if ReplaceSink(sliceSink{}, NewSink(new(bytes.Buffer), JSONFormat)) {
+		t.Error("expected a sink that cannot be compared not to be replaced")
+	}
+	if !ReplaceSink(sink, NewSink(new(bytes.Buffer), JSONFormat)) {
+		t.Error("expected the sink after one that cannot be compared to be replaced")
+	}
+}
+
+// sliceSink is a Sink that cannot be compared with ==.
+type sliceSink struct {
+	lines []string
+}
+
+func (s sliceSink) Write(data []byte) (int, error) { return len(data), nil }
+
+func (s sliceSink) Format() Format { return TextFormat }
+
+// go test -v -test.run TestSetLogstashWriterHandOff ...glog
+func TestSetLogstashWriterHandOff(t *testing.T) {
+	defer func() { WriterSwapPolicy = DrainOnSwap }()
+	WriterSwapPolicy = HandOffOnSwap
+	SetLogstashWriter(new(bytes.Buffer))
+	logstash.WriteWithStack([]byte("W0102 15:04:05.678901 12345 a.go:10] handed off\n"), nil)
+	failover := new(bytes.Buffer)
+	SetLogstashWriter(failover)
+	logstash.flush()
+	if got := decodeEvent(t, failover.Bytes())["message"]; got != "handed off" {
+		t.Errorf("expected the buffered event in the new writer, got %q", failover.String())
+	}
+}
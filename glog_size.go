@@ -0,0 +1,129 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// MaxEventBytes is the maximum size of an encoded event; zero means no maximum.
+// A larger event is reduced until it fits: first its stack is dropped, then its message
+// is trimmed and then its fields other than level, threadid, file and line are dropped,
+// largest first. If it still does not fit, a placeholder event is written instead.
+var MaxEventBytes = 0
+
+// truncatedMark ends a message that was trimmed to fit MaxEventBytes.
+const truncatedMark = "..."
+
+// MaxFieldValueBytes is the maximum size of a string value of @fields, including ExtraFields;
+// zero means no maximum. A larger value is trimmed and ends with "...". The stack is limited
+// by MaxStackBytes instead.
+var MaxFieldValueBytes = 0
+
+// limitFieldValues trims the string values of the fields that exceed MaxFieldValueBytes.
+func limitFieldValues(fields map[string]interface{}) {
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok || len(s) <= MaxFieldValueBytes || key == stackKey {
+			continue
+		}
+		fields[key] = trimMessage(s, MaxFieldValueBytes-len(truncatedMark)) + truncatedMark
+	}
+}
+
+// reduceEvent returns the encoding of the event reduced to fit MaxEventBytes.
+func reduceEvent(log *logJSON, buf []byte) ([]byte, error) {
+	size := len(buf)
+	fits := func() bool {
+		var err error
+		buf, err = marshal(log)
+		return err == nil && len(buf) <= MaxEventBytes
+	}
+	if _, ok := log.Fields[stackKey]; ok {
+		delete(log.Fields, stackKey)
+		delete(log.Fields, stackTopKey)
+		delete(log.Fields, stackTruncatedBytesKey)
+		if fits() {
+			return buf, nil
+		}
+	}
+	if excess := len(buf) - MaxEventBytes; len(log.Message) > 0 {
+		log.Message = trimMessage(log.Message, len(log.Message)-excess-len(truncatedMark)) + truncatedMark
+		if fits() {
+			return buf, nil
+		}
+	}
+	for _, key := range droppableFields(log.Fields) {
+		delete(log.Fields, key)
+		if fits() {
+			return buf, nil
+		}
+	}
+	placeholder := &logJSON{
+		SourceHost: log.SourceHost,
+		TimeStamp:  log.TimeStamp,
+		Fields:     map[string]interface{}{levelKey: log.Fields[levelKey], eventBytesKey: size},
+		Message:    fmt.Sprintf("event of %d bytes dropped, exceeds %d", size, MaxEventBytes),
+	}
+	return marshal(placeholder)
+}
+
+// trimMessage returns at most n bytes of the message, not splitting a character.
+func trimMessage(message string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(message) {
+		return message
+	}
+	for n > 0 && !utf8.RuneStart(message[n]) {
+		n--
+	}
+	return message[:n]
+}
+
+// droppableFields returns the keys of the fields that may be dropped, largest value first.
+func droppableFields(fields map[string]interface{}) []string {
+	bySize := fieldsBySize{sizes: map[string]int{}}
+	for key, value := range fields {
+		switch key {
+		case levelKey, threadidKey, fileKey, lineKey:
+			continue
+		}
+		bySize.keys = append(bySize.keys, key)
+		bySize.sizes[key] = len(fmt.Sprint(value))
+	}
+	sort.Sort(bySize)
+	return bySize.keys
+}
+
+// fieldsBySize sorts keys by the size of their value, largest first, then by key.
+type fieldsBySize struct {
+	keys  []string
+	sizes map[string]int
+}
+
+func (f fieldsBySize) Len() int      { return len(f.keys) }
+func (f fieldsBySize) Swap(i, j int) { f.keys[i], f.keys[j] = f.keys[j], f.keys[i] }
+func (f fieldsBySize) Less(i, j int) bool {
+	if f.sizes[f.keys[i]] != f.sizes[f.keys[j]] {
+		return f.sizes[f.keys[i]] > f.sizes[f.keys[j]]
+	}
+	return f.keys[i] < f.keys[j]
+}
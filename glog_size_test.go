@@ -0,0 +1,103 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+)
+
+// go test -v -test.run TestMaxEventBytes ...glog
+func TestMaxEventBytes(t *testing.T) {
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"request": strings.Repeat("r", 100), "role": "web"}
+	MaxEventBytes = 400
+	defer func() { MaxEventBytes = 0 }()
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] " + strings.Repeat("m", 100) + "\n")
+
+	// dropping the stack is enough
+	buf, _ := WriteWithStack(line, sampleStack)
+	if len(buf) > MaxEventBytes {
+		t.Fatalf("expected at most %d bytes, got %d", MaxEventBytes, len(buf))
+	}
+	event := decodeEvent(t, buf)
+	fields := eventFields(t, event)
+	if _, ok := fields["stack"]; ok {
+		t.Error("expected the stack to be dropped")
+	}
+	if event["message"] != strings.Repeat("m", 100) || fields["request"] == nil {
+		t.Errorf("expected message and fields to be kept, got %v", event)
+	}
+
+	// then the message is trimmed
+	MaxEventBytes = 300
+	buf, _ = WriteWithStack(line, sampleStack)
+	event = decodeEvent(t, buf)
+	message, _ := event["message"].(string)
+	if len(buf) > MaxEventBytes || !strings.HasSuffix(message, "...") || len(message) >= 100 {
+		t.Errorf("expected a trimmed message within %d bytes, got %d bytes: %q", MaxEventBytes, len(buf), message)
+	}
+
+	// then the largest fields are dropped
+	MaxEventBytes = 200
+	buf, _ = WriteWithStack(line, sampleStack)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if len(buf) > MaxEventBytes {
+		t.Errorf("expected at most %d bytes, got %d", MaxEventBytes, len(buf))
+	}
+	if _, ok := fields["request"]; ok {
+		t.Error("expected the largest field to be dropped")
+	}
+	if fields["level"] != "ERROR" || fields["line"] != float64(10) {
+		t.Errorf("expected reserved fields to be kept, got %v", fields)
+	}
+
+	// finally a placeholder
+	MaxEventBytes = 20
+	buf, _ = WriteWithStack(line, sampleStack)
+	event = decodeEvent(t, buf)
+	if got, _ := event["message"].(string); !strings.HasPrefix(got, "event of ") {
+		t.Errorf("expected a placeholder message, got %q", got)
+	}
+	if got := eventFields(t, event)["event_bytes"]; got == nil {
+		t.Error("expected the original size in event_bytes")
+	}
+	// also when indented
+	PrettyAboveSeverity = InfoSeverity
+	defer func() { PrettyAboveSeverity = FatalSeverity }()
+	MaxEventBytes = 400
+	if buf, _ = WriteWithStack(line, sampleStack); len(buf) > MaxEventBytes {
+		t.Errorf("expected at most %d bytes when indented, got %d", MaxEventBytes, len(buf))
+	}
+}
+
+// go test -v -test.run TestMaxFieldValueBytes ...glog
+func TestMaxFieldValueBytes(t *testing.T) {
+	defer func(previous map[string]string) { ExtraFields = previous }(ExtraFields)
+	ExtraFields = map[string]string{"request": strings.Repeat("r", 100), "role": "web"}
+	MaxFieldValueBytes = 20
+	defer func() { MaxFieldValueBytes = 0 }()
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] " + strings.Repeat("m", 100) + "\n")
+
+	fields := eventFields(t, decodeEvent(t, mustWrite(t, line)))
+	if request := fields["request"]; request != strings.Repeat("r", 17)+"..." {
+		t.Errorf("expected a trimmed request of 20 bytes, got %v", request)
+	}
+	if fields["role"] != "web" || fields["line"] != float64(10) {
+		t.Errorf("expected other values to be kept, got %v", fields)
+	}
+}
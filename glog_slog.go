@@ -0,0 +1,176 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package glog
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+)
+
+// Handler is a slog.Handler that writes records as events to the Logstash writer and sinks,
+// such that code using log/slog keeps the logstash json output of this package.
+// Attributes become @fields; the attributes of a group, including those added after
+// WithGroup, are nested in an object with the group name as key.
+type Handler struct {
+	level    slog.Leveler
+	groups   []string      // from WithGroup
+	segments []attrSegment // from WithAttrs
+}
+
+// attrSegment holds the attributes of a WithAttrs call and the groups they are in.
+type attrSegment struct {
+	groups []string
+	attrs  []slog.Attr
+}
+
+// NewHandler returns a Handler for records at or above the level; nil means slog.LevelInfo.
+func NewHandler(level slog.Leveler) *Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &Handler{level: level}
+}
+
+// Enabled is part of the slog.Handler interface.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle is part of the slog.Handler interface.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	sev := slogSeverity(r.Level)
+	file, line := "???", 1
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file, line = filepath.Base(frame.File), frame.Line
+	}
+	fields := map[string]interface{}{}
+	for _, each := range h.segments {
+		addGrouped(fields, each.groups, each.attrs)
+	}
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	addGrouped(fields, h.groups, attrs)
+
+	// the glog line is written to sinks with the TextFormat and EventFormat
+	buf := logging.formatHeader(severity(sev), file, line)
+	buf.WriteString(r.Message)
+	buf.WriteByte('\n')
+	// the event is built under the lock that guards the configuration
+	logging.mu.Lock()
+	if logstash.enabled() && sev >= logstash.threshold {
+		exit := enterPublishing() // hooks may log
+		fields[fileKey], fields[lineKey] = file, line
+		event := NewEvent(sev, r.Message, fields)
+		if !r.Time.IsZero() {
+			event.TimeStamp = r.Time
+		}
+		if !filteredOut((*logJSON)(event)) {
+			logstash.publish(buf.Bytes(), (*logJSON)(event), sev)
+		}
+		exit()
+	}
+	logging.mu.Unlock()
+	logging.putBuffer(buf)
+	return nil
+}
+
+// WithAttrs is part of the slog.Handler interface.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	segments := append(h.segments[:len(h.segments):len(h.segments)], attrSegment{h.groups, attrs})
+	return &Handler{level: h.level, groups: h.groups, segments: segments}
+}
+
+// WithGroup is part of the slog.Handler interface.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &Handler{level: h.level, groups: groups, segments: h.segments}
+}
+
+// addGrouped adds the attributes to the fields, nested in the objects of the groups.
+// Groups without attributes are omitted.
+func addGrouped(fields map[string]interface{}, groups []string, attrs []slog.Attr) {
+	target := map[string]interface{}{}
+	for _, each := range attrs {
+		addAttr(target, each)
+	}
+	if len(target) == 0 {
+		return
+	}
+	for _, name := range groups {
+		nested, ok := fields[name].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			fields[name] = nested
+		}
+		fields = nested
+	}
+	for k, v := range target {
+		fields[k] = v
+	}
+}
+
+// addAttr adds the attribute to the fields; the attributes of a group value are nested.
+func addAttr(fields map[string]interface{}, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		fields[a.Key] = a.Value.Any()
+		return
+	}
+	if a.Key == "" { // inline
+		for _, each := range a.Value.Group() {
+			addAttr(fields, each)
+		}
+		return
+	}
+	group := map[string]interface{}{}
+	for _, each := range a.Value.Group() {
+		addAttr(group, each)
+	}
+	if len(group) > 0 {
+		fields[a.Key] = group
+	}
+}
+
+// slogSeverity maps a slog level to a severity. Debug is Info because glog has no debug severity;
+// levels above Error are Error because Fatal stops the process.
+func slogSeverity(level slog.Level) Severity {
+	switch {
+	case level >= slog.LevelError:
+		return ErrorSeverity
+	case level >= slog.LevelWarn:
+		return WarningSeverity
+	}
+	return InfoSeverity
+}
@@ -0,0 +1,128 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package glog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// captureSlog returns a logger with a Handler and the buffer that receives its events.
+func captureSlog(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	logstash.toLogstash = true
+	capture := new(bytes.Buffer)
+	SetLogstashWriter(capture)
+	t.Cleanup(func() { logstash.toLogstash = false })
+	return slog.New(NewHandler(slog.LevelDebug)), capture
+}
+
+// go test -v -test.run TestSlogHandler ...glog
+func TestSlogHandler(t *testing.T) {
+	logger, capture := captureSlog(t)
+	logger.With("service", "payments").Warn("slow request", "duration", 250*time.Millisecond, "status", 200)
+	logger.Debug("cache miss")
+	logger.Error("failed", slog.Group("request", slog.String("id", "r7")))
+	logstash.flush()
+
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	fields := eventFields(t, events[0])
+	for key, expected := range map[string]interface{}{
+		"level":    "WARNING",
+		"service":  "payments",
+		"duration": float64(250 * time.Millisecond),
+		"status":   float64(200),
+		"file":     "glog_slog_test.go",
+	} {
+		if got := fields[key]; got != expected {
+			t.Errorf("%s: expected %v, got %v", key, expected, got)
+		}
+	}
+	if events[0]["message"] != "slow request" {
+		t.Errorf("expected message, got %v", events[0]["message"])
+	}
+	if got := eventFields(t, events[1])["level"]; got != "INFO" {
+		t.Errorf("expected debug as INFO, got %v", got)
+	}
+	fields = eventFields(t, events[2])
+	request, _ := fields["request"].(map[string]interface{})
+	if fields["level"] != "ERROR" || request["id"] != "r7" {
+		t.Errorf("expected ERROR with a request group, got %v", fields)
+	}
+}
+
+// go test -v -test.run TestSlogHandlerEnabled ...glog
+func TestSlogHandlerEnabled(t *testing.T) {
+	handler := NewHandler(slog.LevelWarn)
+	if handler.Enabled(context.Background(), slog.LevelInfo) || !handler.Enabled(context.Background(), slog.LevelError) {
+		t.Error("expected only records at or above WARN to be enabled")
+	}
+}
+
+// go test -v -test.run TestSlogHandlerWithGroup ...glog
+func TestSlogHandlerWithGroup(t *testing.T) {
+	logger, capture := captureSlog(t)
+	logger.With("service", "payments").WithGroup("http").Info("get", "path", "/pay")
+	logger.WithGroup("http").With("method", "POST").WithGroup("client").Info("post", "ip", "10.0.0.1")
+	logger.WithGroup("empty").Info("no attrs")
+	logstash.flush()
+
+	events := decodeEvents(t, capture.Bytes())
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	fields := eventFields(t, events[0])
+	if http, _ := fields["http"].(map[string]interface{}); fields["service"] != "payments" || http["path"] != "/pay" {
+		t.Errorf("expected service and http.path, got %v", fields)
+	}
+	http, _ := eventFields(t, events[1])["http"].(map[string]interface{})
+	client, _ := http["client"].(map[string]interface{})
+	if http["method"] != "POST" || client["ip"] != "10.0.0.1" {
+		t.Errorf("expected http.method and http.client.ip, got %v", http)
+	}
+	if _, ok := eventFields(t, events[2])["empty"]; ok {
+		t.Error("expected no object for a group without attributes")
+	}
+}
+
+// go test -v -race -test.run TestSlogHandlerConcurrentConfig ...glog
+func TestSlogHandlerConcurrentConfig(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	logger, _ := captureSlog(t)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			IncludeOnSeverity("uptime_ms"+strconv.Itoa(i), ErrorSeverity)
+			SetFieldType("status"+strconv.Itoa(i), IntKind)
+		}
+		done <- true
+	}()
+	for i := 0; i < 1000; i++ {
+		logger.Info("concurrent", "status", "200")
+	}
+	<-done
+	logstash.flush()
+}
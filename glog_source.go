@@ -0,0 +1,102 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SourceCode adds the source line referenced by the file and line of an event as the code field,
+// if the source file is available in the directory set by SetSourceRoot. It is disabled by default
+// because it reads files.
+var SourceCode = false
+
+// sourceRoot is the directory of the source files; empty means no code field.
+var sourceRoot = ""
+
+// SetSourceRoot sets the directory in which the file of an event is looked up for the code field.
+// Glog headers carry the base name of the file, so it is the directory of the sources. Absolute
+// files and files with ".." are not read.
+func SetSourceRoot(dir string) {
+	logging.mu.Lock()
+	sourceRoot = dir
+	sourceCache.Lock()
+	sourceCache.files = map[string][]string{}
+	sourceCache.Unlock()
+	logging.mu.Unlock()
+}
+
+const (
+	maxSourceFileBytes = 1 << 20 // larger files are not read
+	maxSourceFiles     = 64      // number of cached files
+	maxCodeBytes       = 256     // longer lines are cut
+)
+
+// sourceCache holds the lines of source files read for the code field.
+var sourceCache = struct {
+	sync.Mutex
+	files map[string][]string
+}{files: map[string][]string{}}
+
+// sourceLine returns the trimmed line (1-based) of the file in the source root, or false if it is not available.
+func sourceLine(file string, line int) (string, bool) {
+	if sourceRoot == "" || file == "" || filepath.IsAbs(file) || filepath.VolumeName(file) != "" {
+		return "", false
+	}
+	for _, each := range strings.Split(filepath.ToSlash(file), "/") {
+		if each == ".." {
+			return "", false
+		}
+	}
+	file = filepath.Join(sourceRoot, file)
+	sourceCache.Lock()
+	defer sourceCache.Unlock()
+	lines, ok := sourceCache.files[file]
+	if !ok {
+		lines = readSourceLines(file)
+		if len(sourceCache.files) >= maxSourceFiles {
+			sourceCache.files = map[string][]string{}
+		}
+		sourceCache.files[file] = lines // also cache a failure
+	}
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	code := strings.TrimSpace(lines[line-1])
+	if len(code) > maxCodeBytes {
+		code = code[:maxCodeBytes]
+	}
+	return code, true
+}
+
+// readSourceLines returns the lines of a file or nil if it cannot be read or is too large.
+func readSourceLines(file string) []string {
+	info, err := os.Stat(file)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSourceFileBytes {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || bytes.IndexByte(data, 0) != -1 { // not a text file
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
@@ -0,0 +1,58 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v -test.run TestSourceCode ...glog
+func TestSourceCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "x.go")
+	ioutil.WriteFile(source, []byte("package x\n\nfunc f() {\n\tglog.Error(\"failed\")\n}\n"), 0644)
+
+	defer RestoreConfig(SnapshotConfig())
+	SourceCode = true
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 x.go:4] failed\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["code"]; ok {
+		t.Error("expected no code without source root")
+	}
+	SetSourceRoot(dir)
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 x.go:4] failed\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["code"]; got != `glog.Error("failed")` {
+		t.Errorf("expected source line 4, got %v", got)
+	}
+
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 x.go:40] failed\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["code"]; ok {
+		t.Error("expected no code for a line beyond the file")
+	}
+	for _, each := range []string{"missing.go", source, "../" + filepath.Base(dir) + "/x.go"} {
+		buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 "+each+":4] failed\n"), nil)
+		if _, ok := eventFields(t, decodeEvent(t, buf))["code"]; ok {
+			t.Errorf("%s: expected no code outside the source root", each)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stackFrame is a single call in a goroutine stack trace as written by runtime.Stack.
+type stackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// MaxStackBytes is the maximum size of the stack field; zero means no maximum.
+// A larger stack is cut and summarized by its top StackTopFrames frames in the stack_top field.
+var MaxStackBytes = 0
+
+// StackTopFrames is the number of frames kept in stack_top when a stack exceeds MaxStackBytes.
+var StackTopFrames = 10
+
+// StackDedupWindow suppresses repeated identical stacks: within the window after a stack
+// is written, events with the same stack only get its short hash in the stack_ref field.
+// The first event also has the stack_ref so both can be correlated. Zero disables it.
+var StackDedupWindow time.Duration
+
+// seenStacks holds when each stack, by hash, was last written in full.
+var seenStacks = struct {
+	sync.Mutex
+	written map[string]time.Time
+}{written: map[string]time.Time{}}
+
+const maxSeenStacks = 1024
+
+// stackRef returns the hash of the trace and whether it was written in full within the window.
+func stackRef(trace []byte) (string, bool) {
+	hash := fnv.New64a()
+	hash.Write(trace)
+	ref := strconv.FormatUint(hash.Sum64(), 16)
+	now := timeNow()
+	seenStacks.Lock()
+	defer seenStacks.Unlock()
+	if written, ok := seenStacks.written[ref]; ok && now.Sub(written) < StackDedupWindow {
+		return ref, true
+	}
+	if len(seenStacks.written) >= maxSeenStacks {
+		for each, written := range seenStacks.written {
+			if now.Sub(written) >= StackDedupWindow {
+				delete(seenStacks.written, each)
+			}
+		}
+		if len(seenStacks.written) >= maxSeenStacks {
+			seenStacks.written = map[string]time.Time{}
+		}
+	}
+	seenStacks.written[ref] = now
+	return ref, false
+}
+
+// addStack adds the stack to the fields of the event, bounded by MaxStackBytes.
+func addStack(log *logJSON, trace []byte) {
+	if StackDedupWindow > 0 {
+		ref, seen := stackRef(trace)
+		log.Fields[stackRefKey] = ref
+		if seen {
+			return
+		}
+	}
+	if MaxStackBytes <= 0 || len(trace) <= MaxStackBytes {
+		log.Fields[stackKey] = stackValue(trace)
+		return
+	}
+	frames, truncated := parseStackFrames(trace)
+	if truncated {
+		log.Fields[stackFramesTruncatedKey] = true
+	}
+	if len(frames) > StackTopFrames {
+		frames = frames[:StackTopFrames]
+	}
+	log.Fields[stackKey] = stackValue(trace[:MaxStackBytes])
+	log.Fields[stackTopKey] = frames
+	log.Fields[stackTruncatedBytesKey] = len(trace) - MaxStackBytes
+}
+
+// StackAsLines writes the stack field as an array of its lines instead of a single string.
+var StackAsLines = false
+
+// StackOrigin adds the origin field with the first frame of the stack that is not in
+// a package with one of the origin skip prefixes, which is usually the most useful one.
+var StackOrigin = false
+
+// HasStack adds the has_stack field, which tells whether a non-empty stack was attached to the event.
+var HasStack = false
+
+// stackPredicate decides whether an event gets its stack, see SetStackPredicate.
+var stackPredicate func(ev *Event) bool
+
+// SetStackPredicate sets a function that decides per event whether its stack is written,
+// e.g. based on the message or fields. It sees the event before optional fields are added.
+// A stack the predicate returns false for is dropped. Pass nil to write all stacks.
+func SetStackPredicate(predicate func(ev *Event) bool) {
+	logging.mu.Lock()
+	stackPredicate = predicate
+	logging.mu.Unlock()
+}
+
+// originSkipPrefixes are the function prefixes of frames that are not an origin.
+var originSkipPrefixes = []string{"runtime.", "github.com/clamoriniere1A/glog."}
+
+// SetOriginSkipPrefixes sets the function prefixes, e.g. "runtime." or "github.com/lib/log.",
+// of frames that are skipped to find the origin.
+func SetOriginSkipPrefixes(prefixes ...string) {
+	logging.mu.Lock()
+	originSkipPrefixes = prefixes
+	logging.mu.Unlock()
+}
+
+// stackOrigin returns the first frame that is not skipped or false if there is none.
+func stackOrigin(trace []byte) (stackFrame, bool) {
+	frames, _ := parseStackFrames(trace)
+next:
+	for _, each := range frames {
+		for _, prefix := range originSkipPrefixes {
+			if strings.HasPrefix(each.Function, prefix) {
+				continue next
+			}
+		}
+		return each, true
+	}
+	return stackFrame{}, false
+}
+
+// StackIndent replaces the tab that indents the file lines of the stack field, e.g. "    ".
+// The stack keeps its lines; its newlines are escaped in the JSON string. Empty keeps the tab.
+var StackIndent = ""
+
+// stackValue returns the value of the stack field for the trace.
+func stackValue(trace []byte) interface{} {
+	if StackIndent != "" {
+		trace = bytes.Replace(trace, []byte("\n\t"), []byte("\n"+StackIndent), -1)
+	}
+	if !StackAsLines {
+		return string(trace)
+	}
+	return strings.Split(strings.TrimSuffix(string(trace), "\n"), "\n")
+}
+
+// parseStack decodes the frames of all goroutines in a trace.
+//
+//	goroutine 1 [running]:
+//	main.main()
+//		/path/main.go:10 +0x20
+func parseStack(trace []byte) []stackFrame {
+	frames, _ := parseStackFrames(trace)
+	return frames
+}
+
+// MaxStackFrames bounds the number of frames parsed from a stack, e.g. for stack_depth or
+// stack_top; zero means no maximum. Events with more frames get stack_frames_truncated.
+var MaxStackFrames = 0
+
+// parseStackFrames decodes at most MaxStackFrames frames and returns whether the trace has more.
+func parseStackFrames(trace []byte) ([]stackFrame, bool) {
+	frames := []stackFrame{}
+	lines := bytes.Split(trace, []byte{10})
+	for i := 0; i+1 < len(lines); i++ {
+		location := lines[i+1]
+		if len(location) == 0 || location[0] != 9 || len(lines[i]) == 0 || lines[i][0] == 9 {
+			continue
+		}
+		frame := stackFrame{Function: string(bytes.TrimPrefix(lines[i], []byte("created by ")))}
+		location = location[1:]
+		// strip the pc offset
+		if space := bytes.LastIndexByte(location, 32); space != -1 && bytes.HasPrefix(location[space+1:], []byte("+0x")) {
+			location = location[:space]
+		}
+		if colon := bytes.LastIndexByte(location, 58); colon != -1 {
+			frame.File = string(location[:colon])
+			frame.Line, _ = strconv.Atoi(string(location[colon+1:]))
+		} else {
+			frame.File = string(location)
+		}
+		if MaxStackFrames > 0 && len(frames) == MaxStackFrames {
+			return frames, true
+		}
+		frames = append(frames, frame)
+		i++ // past location
+	}
+	return frames, false
+}
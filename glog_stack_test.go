@@ -0,0 +1,271 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var sampleStack = []byte(`goroutine 1 [running]:
+github.com/clamoriniere1A/glog.stacks(0x0, 0x0, 0x0, 0x0)
+	/go/src/github.com/clamoriniere1A/glog/glog.go:782 +0x8e
+github.com/clamoriniere1A/glog.(*loggingT).output(0x5a8ec0, 0x3, 0xc82000e0f0, 0x582d75, 0x7, 0x1e, 0x0)
+	/go/src/github.com/clamoriniere1A/glog/glog.go:722 +0x5a5
+main.main()
+	/go/src/example/main.go:10 +0x20
+
+goroutine 17 [syscall, locked to thread]:
+runtime.goexit()
+	/usr/local/go/src/runtime/asm_amd64.s:1998 +0x1
+created by main.start
+	/go/src/example/main.go:22 +0x44
+`)
+
+// go test -v -test.run TestParseStack ...glog
+func TestParseStack(t *testing.T) {
+	frames := parseStack(sampleStack)
+	if len(frames) != 5 {
+		t.Fatalf("expected 5 frames, got %d: %v", len(frames), frames)
+	}
+	if got := frames[2]; got.Function != "main.main()" || got.File != "/go/src/example/main.go" || got.Line != 10 {
+		t.Errorf("unexpected frame %v", got)
+	}
+	if got := frames[4]; got.Function != "main.start" || got.Line != 22 {
+		t.Errorf("unexpected created by frame %v", got)
+	}
+}
+
+// go test -v -test.run TestStackDepth ...glog
+func TestStackDepth(t *testing.T) {
+	StackDepth = true
+	defer func() { StackDepth = false }()
+	buf, err := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventFields(t, decodeEvent(t, buf))["stack_depth"]; got != float64(5) {
+		t.Errorf("expected stack_depth 5, got %v", got)
+	}
+}
+
+// go test -v -test.run TestMaxStackBytes ...glog
+func TestMaxStackBytes(t *testing.T) {
+	MaxStackBytes = 64
+	StackTopFrames = 2
+	defer func() {
+		MaxStackBytes = 0
+		StackTopFrames = 10
+	}()
+	buf, err := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := eventFields(t, decodeEvent(t, buf))
+	if got := fields["stack"]; got != string(sampleStack[:64]) {
+		t.Errorf("expected stack cut at 64 bytes, got %q", got)
+	}
+	if got := fields["stack_truncated_bytes"]; got != float64(len(sampleStack)-64) {
+		t.Errorf("expected stack_truncated_bytes %d, got %v", len(sampleStack)-64, got)
+	}
+	top, _ := fields["stack_top"].([]interface{})
+	if len(top) != 2 {
+		t.Fatalf("expected 2 frames in stack_top, got %v", fields["stack_top"])
+	}
+	if frame := top[1].(map[string]interface{}); frame["line"] != float64(722) || frame["file"] != "/go/src/github.com/clamoriniere1A/glog/glog.go" {
+		t.Errorf("unexpected frame %v", frame)
+	}
+}
+
+// go test -v -test.run TestStackDedupWindow ...glog
+func TestStackDedupWindow(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	StackDedupWindow = time.Minute
+	defer func() { StackDedupWindow = 0 }()
+	// stacks written by earlier runs are within the window
+	seenStacks.Lock()
+	seenStacks.written = map[string]time.Time{}
+	seenStacks.Unlock()
+
+	write := func() map[string]interface{} {
+		buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+		return eventFields(t, decodeEvent(t, buf))
+	}
+	first := write()
+	if first["stack"] != string(sampleStack) || first["stack_ref"] == nil {
+		t.Fatalf("expected stack and stack_ref on the first event, got %v", first)
+	}
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		next := write()
+		if _, ok := next["stack"]; ok {
+			t.Errorf("expected no stack on a repeated event")
+		}
+		if next["stack_ref"] != first["stack_ref"] {
+			t.Errorf("expected stack_ref %v, got %v", first["stack_ref"], next["stack_ref"])
+		}
+	}
+	now = now.Add(time.Minute)
+	if got := write(); got["stack"] != string(sampleStack) {
+		t.Errorf("expected the stack again after the window, got %v", got)
+	}
+}
+
+// go test -v -test.run TestSplitEmbeddedStack ...glog
+func TestSplitEmbeddedStack(t *testing.T) {
+	SplitEmbeddedStack = true
+	defer func() { SplitEmbeddedStack = false }()
+	data := append([]byte("E0102 15:04:05.678901 12345 a.go:10] recovered: boom\n"), sampleStack...)
+	buf, _ := WriteWithStack(data, nil)
+	event := decodeEvent(t, buf)
+	if got := event["message"]; got != "recovered: boom" {
+		t.Errorf("expected the message without trace, got %q", got)
+	}
+	if got := eventFields(t, event)["stack"]; got != string(sampleStack) {
+		t.Errorf("expected the embedded trace as stack, got %q", got)
+	}
+
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] no trace here\n"), nil)
+	if _, ok := eventFields(t, decodeEvent(t, buf))["stack"]; ok {
+		t.Error("expected no stack without an embedded trace")
+	}
+}
+
+// go test -v -test.run TestStackAsLines ...glog
+func TestStackAsLines(t *testing.T) {
+	StackAsLines = true
+	defer func() { StackAsLines = false }()
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	lines, ok := eventFields(t, decodeEvent(t, buf))["stack"].([]interface{})
+	if !ok {
+		t.Fatalf("expected the stack as an array")
+	}
+	expected := strings.Split(strings.TrimSuffix(string(sampleStack), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i, each := range expected {
+		if lines[i] != each {
+			t.Errorf("line %d: expected %q, got %q", i, each, lines[i])
+		}
+	}
+}
+
+// go test -v -test.run TestStackIndent ...glog
+func TestStackIndent(t *testing.T) {
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] failed\n")
+	buf, _ := WriteWithStack(line, sampleStack)
+	if !strings.Contains(string(buf), `main.main()\n\t/go/src/example/main.go:10 +0x20\n`) {
+		t.Errorf("expected escaped newlines and tabs in the compact event, got %s", buf)
+	}
+	if got := eventFields(t, decodeEvent(t, buf))["stack"]; got != string(sampleStack) {
+		t.Errorf("expected the stack with its lines, got %q", got)
+	}
+
+	StackIndent = "    "
+	defer func() { StackIndent = "" }()
+	buf, _ = WriteWithStack(line, sampleStack)
+	stack, _ := eventFields(t, decodeEvent(t, buf))["stack"].(string)
+	if !strings.Contains(stack, "main.main()\n    /go/src/example/main.go:10 +0x20\n") || strings.Contains(stack, "\t") {
+		t.Errorf("expected the file lines indented by spaces, got %q", stack)
+	}
+}
+
+// go test -v -test.run TestMaxStackFrames ...glog
+func TestMaxStackFrames(t *testing.T) {
+	StackDepth = true
+	MaxStackFrames = 3
+	defer func() {
+		StackDepth = false
+		MaxStackFrames = 0
+	}()
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	fields := eventFields(t, decodeEvent(t, buf))
+	if fields["stack_depth"] != float64(3) || fields["stack_frames_truncated"] != true {
+		t.Errorf("expected 3 frames and stack_frames_truncated, got %v and %v", fields["stack_depth"], fields["stack_frames_truncated"])
+	}
+
+	MaxStackFrames = 5
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	fields = eventFields(t, decodeEvent(t, buf))
+	if _, ok := fields["stack_frames_truncated"]; ok || fields["stack_depth"] != float64(5) {
+		t.Errorf("expected all 5 frames without truncation, got %v", fields)
+	}
+}
+
+// go test -v -test.run TestStackOrigin ...glog
+func TestStackOrigin(t *testing.T) {
+	StackOrigin = true
+	defer func() { StackOrigin = false }()
+	buf, _ := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	origin, _ := eventFields(t, decodeEvent(t, buf))["origin"].(map[string]interface{})
+	if origin["function"] != "main.main()" || origin["file"] != "/go/src/example/main.go" || origin["line"] != float64(10) {
+		t.Errorf("expected main.main as origin, got %v", origin)
+	}
+
+	defer SetOriginSkipPrefixes("runtime.", "github.com/clamoriniere1A/glog.")
+	SetOriginSkipPrefixes("runtime.", "github.com/", "main.main")
+	buf, _ = WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] failed\n"), sampleStack)
+	origin, _ = eventFields(t, decodeEvent(t, buf))["origin"].(map[string]interface{})
+	if origin["function"] != "main.start" || origin["line"] != float64(22) {
+		t.Errorf("expected main.start as origin, got %v", origin)
+	}
+}
+
+// go test -v -test.run TestHasStack ...glog
+func TestHasStack(t *testing.T) {
+	HasStack = true
+	defer func() { HasStack = false }()
+	line := []byte("E0102 15:04:05.678901 12345 a.go:10] failed\n")
+	for _, each := range []struct {
+		stack    []byte
+		expected bool
+	}{{sampleStack, true}, {nil, false}, {[]byte{}, false}} {
+		buf, err := WriteWithStack(line, each.stack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventFields(t, decodeEvent(t, buf))["has_stack"]; got != each.expected {
+			t.Errorf("expected has_stack %v for %d bytes of stack, got %v", each.expected, len(each.stack), got)
+		}
+	}
+}
+
+// go test -v -test.run TestSetStackPredicate ...glog
+func TestSetStackPredicate(t *testing.T) {
+	SetStackPredicate(func(ev *Event) bool { return strings.Contains(ev.Message, "timeout") })
+	defer SetStackPredicate(nil)
+	HasStack = true
+	defer func() { HasStack = false }()
+
+	for _, each := range []struct {
+		message string
+		stack   bool
+	}{{"query timeout", true}, {"not found", false}} {
+		buf, err := WriteWithStack([]byte("E0102 15:04:05.678901 12345 a.go:10] "+each.message+"\n"), sampleStack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := eventFields(t, decodeEvent(t, buf))
+		if _, ok := fields["stack"]; ok != each.stack || fields["has_stack"] != each.stack {
+			t.Errorf("%q: expected stack %v, got %v", each.message, each.stack, fields)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// staticFields holds the @fields elements loaded by LoadStaticFieldsFromFile; guarded by extraFieldsMu.
+var staticFields = map[string]interface{}{}
+
+// LoadStaticFieldsFromFile reads a JSON object from the file, e.g. mounted into a container,
+// and adds its members to the @fields of each event, as SetExtraField does. Calling it again,
+// e.g. on a SIGHUP, reloads the file: members that are no longer in it are removed.
+// Its members take precedence over ExtraFields and SetExtraField elements with the same key,
+// which are used again when the member is removed from the file.
+// If the file cannot be read or is not a JSON object, the fields are not changed.
+func LoadStaticFieldsFromFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("static fields %s: %v", path, err)
+	}
+	extraFieldsMu.Lock()
+	staticFields = fields
+	extraFieldsMu.Unlock()
+	return nil
+}
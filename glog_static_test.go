@@ -0,0 +1,71 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v -test.run TestLoadStaticFieldsFromFile ...glog
+func TestLoadStaticFieldsFromFile(t *testing.T) {
+	defer RestoreConfig(SnapshotConfig())
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fields.json")
+	ioutil.WriteFile(path, []byte(`{"cluster":"prod-eu","replicas":3,"owner":{"team":"payments"}}`), 0644)
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] enriched\n")
+	SetExtraField("replicas", 1)
+
+	if err := LoadStaticFieldsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	fields := eventFields(t, decodeEvent(t, mustWrite(t, line)))
+	owner, _ := fields["owner"].(map[string]interface{})
+	if fields["cluster"] != "prod-eu" || fields["replicas"] != float64(3) || owner["team"] != "payments" {
+		t.Errorf("expected the static fields, got %v", fields)
+	}
+
+	// reload
+	ioutil.WriteFile(path, []byte(`{"cluster":"prod-us"}`), 0644)
+	if err := LoadStaticFieldsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	fields = eventFields(t, decodeEvent(t, mustWrite(t, line)))
+	if fields["cluster"] != "prod-us" || fields["owner"] != nil {
+		t.Errorf("expected the reloaded static fields, got %v", fields)
+	}
+	if fields["replicas"] != float64(1) {
+		t.Errorf("expected the extra field that was in the file to be kept, got %v", fields["replicas"])
+	}
+
+	ioutil.WriteFile(path, []byte(`["not", "an", "object"]`), 0644)
+	if err := LoadStaticFieldsFromFile(path); err == nil {
+		t.Error("expected an error for a JSON array")
+	}
+	if err := LoadStaticFieldsFromFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if got := SnapshotExtraFields()["cluster"]; got != "prod-us" {
+		t.Errorf("expected the fields to be kept after an error, got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// syslogLineFields lists the @fields keys that are appended to a syslog line.
+var syslogLineFields []string
+
+// SetSyslogLineFields sets the @fields keys that RenderSyslogLine appends as key=value,
+// e.g. "threadid" or "host_ip". Fields that an event does not have are skipped.
+func SetSyslogLineFields(keys []string) {
+	logging.mu.Lock()
+	syslogLineFields = keys
+	logging.mu.Unlock()
+}
+
+// severityIcons maps severities to the icon that replaces the level in rendered lines.
+var severityIcons map[Severity]string
+
+// SetSeverityIcons sets icons, e.g. "⚠️" for WarningSeverity, that replace the level in the lines
+// of RenderSyslogLine, for readable local output. JSON events are not affected. Pass nil to remove them.
+func SetSeverityIcons(icons map[Severity]string) {
+	logging.mu.Lock()
+	severityIcons = icons
+	logging.mu.Unlock()
+}
+
+// severityOfEvent returns the severity named by the level field of the event; Info if unknown.
+func severityOfEvent(ev *Event) Severity {
+	level, _ := ev.Fields[levelKey].(string)
+	for sev := InfoSeverity; sev <= FatalSeverity; sev++ {
+		if levelName(sev) == level {
+			return sev
+		}
+	}
+	return InfoSeverity
+}
+
+// RenderSyslogLine returns a compact single-line text for the body of a syslog message:
+//
+//	LEVEL file:line message key=value ...
+//
+// The level is replaced by its icon if set by SetSeverityIcons.
+// It is used for Sinks with the SyslogFormat.
+func RenderSyslogLine(ev *Event) string {
+	line := new(bytes.Buffer)
+	if level, ok := ev.Fields[levelKey]; ok {
+		if icon, ok := severityIcons[severityOfEvent(ev)]; ok {
+			level = icon
+		}
+		fmt.Fprint(line, level, " ")
+	}
+	if file, ok := ev.Fields[fileKey]; ok {
+		fmt.Fprint(line, file, ":", ev.Fields[lineKey], " ")
+	}
+	line.WriteString(ev.Message)
+	for _, key := range syslogLineFields {
+		if value, ok := ev.Fields[key]; ok {
+			fmt.Fprintf(line, " %s=%v", key, value)
+		}
+	}
+	return string(bytes.Replace(line.Bytes(), []byte{10}, []byte{32}, -1))
+}
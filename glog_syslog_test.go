@@ -0,0 +1,71 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"testing"
+)
+
+// go test -v -test.run TestRenderSyslogLine ...glog
+func TestRenderSyslogLine(t *testing.T) {
+	log, _ := parseEvent([]byte("E0102 15:04:05.678901 12345 a.go:10] disk failed\n"), nil)
+	if got, want := RenderSyslogLine((*Event)(log)), "ERROR a.go:10 disk failed"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	SetSyslogLineFields([]string{"threadid", "missing"})
+	defer SetSyslogLineFields(nil)
+	if got, want := RenderSyslogLine((*Event)(log)), "ERROR a.go:10 disk failed threadid=12345"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := RenderSyslogLine(NewEvent(InfoSeverity, "two\nlines", nil)), "INFO two lines"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// go test -v -test.run TestSyslogFormatSink ...glog
+func TestSyslogFormatSink(t *testing.T) {
+	defer func() { logstash.sinks = nil }()
+	out := new(bytes.Buffer)
+	AddSink(NewSink(out, SyslogFormat))
+	SetLogstashWriter(new(bytes.Buffer))
+	logstash.WriteWithStack([]byte("W0102 15:04:05.678901 12345 a.go:10] careful\n"), nil)
+	logstash.flush()
+	if got, want := out.String(), "WARNING a.go:10 careful\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// go test -v -test.run TestSeverityIcons ...glog
+func TestSeverityIcons(t *testing.T) {
+	SetSeverityIcons(map[Severity]string{WarningSeverity: "⚠️", ErrorSeverity: "❌"})
+	defer SetSeverityIcons(nil)
+	for data, want := range map[string]string{
+		"W0102 15:04:05.678901 12345 a.go:10] careful\n": "⚠️ a.go:10 careful",
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  "❌ a.go:10 failed",
+		"I0102 15:04:05.678901 12345 a.go:10] hello\n":   "INFO a.go:10 hello",
+	} {
+		log, _ := parseEvent([]byte(data), nil)
+		if got := RenderSyslogLine((*Event)(log)); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+	buf, _ := WriteWithStack([]byte("W0102 15:04:05.678901 12345 a.go:10] careful\n"), nil)
+	if got := eventFields(t, decodeEvent(t, buf))["level"]; got != "WARNING" {
+		t.Errorf("expected the JSON level unaffected, got %v", got)
+	}
+}
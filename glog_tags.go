@@ -0,0 +1,83 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import "strings"
+
+// tagRule adds a tag to events that match its predicate.
+type tagRule struct {
+	predicate func(*Event) bool
+	tag       string
+}
+
+// MaxTags is the maximum number of tags of an event; zero means no maximum.
+var MaxTags = 0
+
+// TagPolicy identifies which tags are dropped when an event has more than MaxTags.
+type TagPolicy int
+
+const (
+	DropNewTags TagPolicy = iota // tags of later rules are dropped
+	DropOldTags                  // tags of earlier rules are dropped
+)
+
+// TagOverflowPolicy is applied when an event has more than MaxTags.
+var TagOverflowPolicy = DropNewTags
+
+// tagRules are evaluated in order for each event.
+var tagRules []tagRule
+
+// AddTagRule appends the tag to the tags array of @fields of each event for which the predicate returns true.
+// Multiple rules can match the same event; each tag is added once.
+func AddTagRule(predicate func(*Event) bool, tag string) {
+	logging.mu.Lock()
+	tagRules = append(tagRules, tagRule{predicate, tag})
+	logging.mu.Unlock()
+}
+
+// AddPackageTag appends the tag to the tags of events from files whose name contains
+// the substring, e.g. "storage_" for storage_db.go and storage_cache.go. Glog headers carry
+// the base name of the file, so the substring cannot match a directory of the package.
+func AddPackageTag(fileSubstring, tag string) {
+	AddTagRule(func(event *Event) bool {
+		file, _ := event.Fields[fileKey].(string)
+		return strings.Contains(file, fileSubstring)
+	}, tag)
+}
+
+// addTags evaluates the tag rules for the event.
+func addTags(log *logJSON) {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, each := range tagRules {
+		if seen[each.tag] || !each.predicate((*Event)(log)) {
+			continue
+		}
+		seen[each.tag] = true
+		tags = append(tags, each.tag)
+	}
+	if MaxTags > 0 && len(tags) > MaxTags {
+		if TagOverflowPolicy == DropOldTags {
+			tags = tags[len(tags)-MaxTags:]
+		} else {
+			tags = tags[:MaxTags]
+		}
+	}
+	if len(tags) > 0 {
+		log.Fields[tagsKey] = tags
+	}
+}
@@ -0,0 +1,95 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"reflect"
+	"testing"
+)
+
+// eventTags returns the tags of an encoded event.
+func eventTags(t *testing.T, buf []byte) []string {
+	tags := []string{}
+	list, _ := eventFields(t, decodeEvent(t, buf))["tags"].([]interface{})
+	for _, each := range list {
+		tags = append(tags, each.(string))
+	}
+	return tags
+}
+
+// go test -v -test.run TestTagRules ...glog
+func TestTagRules(t *testing.T) {
+	defer func() { tagRules = nil }()
+	AddTagRule(func(e *Event) bool { return e.Fields["level"] == "ERROR" }, "error")
+	AddTagRule(func(e *Event) bool { return e.Fields["file"] == "db.go" }, "database")
+
+	for data, expected := range map[string][]string{
+		"E0102 15:04:05.678901 12345 db.go:10] failed\n": {"error", "database"},
+		"I0102 15:04:05.678901 12345 db.go:10] query\n":  {"database"},
+		"E0102 15:04:05.678901 12345 a.go:10] failed\n":  {"error"},
+		"I0102 15:04:05.678901 12345 a.go:10] hello\n":   {},
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		if got := eventTags(t, buf); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected tags %v, got %v", data, expected, got)
+		}
+	}
+}
+
+// go test -v -test.run TestMaxTags ...glog
+func TestMaxTags(t *testing.T) {
+	defer func() {
+		tagRules = nil
+		MaxTags = 0
+		TagOverflowPolicy = DropNewTags
+	}()
+	always := func(e *Event) bool { return true }
+	for _, tag := range []string{"a", "b", "a", "c", "d"} {
+		AddTagRule(always, tag)
+	}
+	line := []byte("I0102 15:04:05.678901 12345 a.go:10] hello\n")
+	buf, _ := WriteWithStack(line, nil)
+	if got := eventTags(t, buf); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("expected deduplicated tags, got %v", got)
+	}
+	MaxTags = 2
+	buf, _ = WriteWithStack(line, nil)
+	if got := eventTags(t, buf); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("expected first 2 tags, got %v", got)
+	}
+	TagOverflowPolicy = DropOldTags
+	buf, _ = WriteWithStack(line, nil)
+	if got := eventTags(t, buf); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("expected last 2 tags, got %v", got)
+	}
+}
+
+// go test -v -test.run TestAddPackageTag ...glog
+func TestAddPackageTag(t *testing.T) {
+	defer func() { tagRules = nil }()
+	AddPackageTag("storage_", "storage")
+
+	for data, expected := range map[string][]string{
+		"I0102 15:04:05.678901 12345 storage_db.go:10] query\n": {"storage"},
+		"I0102 15:04:05.678901 12345 handler.go:10] get\n":      {},
+	} {
+		buf, _ := WriteWithStack([]byte(data), nil)
+		if got := eventTags(t, buf); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected tags %v, got %v", data, expected, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// UnixSocketWriter writes newline delimited JSON events to a unix domain socket,
+// e.g. of a local log collector. It connects on the first write and reconnects
+// once when a write fails. Use it with SetLogstashWriter or NewSink.
+type UnixSocketWriter struct {
+	network string
+	path    string
+	mu      sync.Mutex
+	conn    net.Conn
+	pending []byte // the incomplete line
+}
+
+// NewUnixSocketWriter returns a UnixSocketWriter for the stream socket at path.
+func NewUnixSocketWriter(path string) *UnixSocketWriter {
+	return &UnixSocketWriter{network: "unix", path: path}
+}
+
+// NewUnixDatagramWriter returns a UnixSocketWriter for the datagram socket at path.
+// Each event is sent as one datagram.
+func NewUnixDatagramWriter(path string) *UnixSocketWriter {
+	return &UnixSocketWriter{network: "unixgram", path: path}
+}
+
+// Write is for implementing io.Writer. Data is sent when it completes a line; each line is
+// sent with a separate write. Lines that could not be sent are kept, such that a retry or
+// the next line sends them, and an error is returned.
+func (u *UnixSocketWriter) Write(data []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending = append(u.pending, data...)
+	end := bytes.LastIndexByte(u.pending, '\n') + 1
+	if end == 0 {
+		return len(data), nil
+	}
+	lines := u.pending[:end]
+	for len(lines) > 0 {
+		next := bytes.IndexByte(lines, '\n') + 1
+		if next > 1 { // empty lines are not sent
+			if err := u.sendOrReconnect(lines[:next]); err != nil {
+				u.keep(lines, u.pending[end:])
+				return 0, err
+			}
+		}
+		lines = lines[next:]
+	}
+	u.pending = append(u.pending[:0], u.pending[end:]...)
+	return len(data), nil
+}
+
+// maxPendingBytes limits the unsent lines that are kept while the socket is unavailable.
+const maxPendingBytes = 1 << 20
+
+// keep replaces the pending data by the unsent lines and the incomplete line.
+// The oldest lines are dropped when it exceeds maxPendingBytes.
+func (u *UnixSocketWriter) keep(unsent, incomplete []byte) {
+	kept := make([]byte, 0, len(unsent)+len(incomplete))
+	kept = append(append(kept, unsent...), incomplete...)
+	for len(kept) > maxPendingBytes {
+		next := bytes.IndexByte(kept, '\n') + 1
+		if next == 0 {
+			break
+		}
+		kept = kept[next:]
+	}
+	u.pending = kept
+}
+
+// sendOrReconnect sends the line and reconnects once when that fails.
+func (u *UnixSocketWriter) sendOrReconnect(line []byte) error {
+	if err := u.send(line); err != nil {
+		// the collector may have restarted
+		u.close()
+		if err = u.send(line); err != nil {
+			u.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes the line, connecting first if needed.
+func (u *UnixSocketWriter) send(line []byte) error {
+	if u.conn == nil {
+		conn, err := net.Dial(u.network, u.path)
+		if err != nil {
+			return err
+		}
+		u.conn = conn
+	}
+	_, err := u.conn.Write(line)
+	return err
+}
+
+// close drops the connection so the next send reconnects.
+func (u *UnixSocketWriter) close() {
+	if u.conn != nil {
+		u.conn.Close()
+		u.conn = nil
+	}
+}
+
+// Close closes the connection to the socket.
+func (u *UnixSocketWriter) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.close()
+	return nil
+}
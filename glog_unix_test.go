@@ -0,0 +1,107 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Modifications copyright 2013 Ernest Micklei. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v -test.run TestUnixSocketWriter ...glog
+func TestUnixSocketWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets not available:", err)
+	}
+	defer listener.Close()
+	events := make(chan map[string]interface{}, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			event := map[string]interface{}{}
+			json.NewDecoder(conn).Decode(&event)
+			events <- event
+			conn.Close() // forces a reconnect for the next event
+		}
+	}()
+
+	writer := NewUnixSocketWriter(path)
+	defer writer.Close()
+	sink := newBufferedWriter(writer)
+	for _, each := range []string{"first", "second"} {
+		buf, _ := WriteWithStack([]byte("I0102 15:04:05.678901 12345 a.go:10] "+each+"\n"), nil)
+		sink.Write(buf)
+		sink.Write([]byte("\n"))
+		sink.flush()
+		if got := (<-events)["message"]; got != each {
+			t.Errorf("expected %q, got %v", each, got)
+		}
+	}
+}
+
+// go test -v -test.run TestUnixSocketWriterKeepsLine ...glog
+func TestUnixSocketWriterKeepsLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.sock")
+	writer := NewUnixSocketWriter(path)
+	defer writer.Close()
+	writer.Write([]byte(`{"message":"kept"}`))
+	if _, err := writer.Write([]byte("\n")); err == nil {
+		t.Fatal("expected an error without collector")
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets not available:", err)
+	}
+	defer listener.Close()
+	events := make(chan map[string]interface{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		event := map[string]interface{}{}
+		json.NewDecoder(conn).Decode(&event)
+		events <- event
+	}()
+	// the retry of the delimiter sends the kept line
+	if _, err := writer.Write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := (<-events)["message"]; got != "kept" {
+		t.Errorf("expected kept, got %v", got)
+	}
+}